@@ -2,9 +2,9 @@ package api
 
 import (
 	"bytes"
-	"database/sql"
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"io"
 	"log"
 	"net/http"
@@ -17,24 +17,43 @@ import (
 	"Webex.API.Integration.And.Visualization/types"
 )
 
-const (
-	AUTH_URL  = "https://webexapis.com/v1/authorize"
-	TOKEN_URL = "https://webexapis.com/v1/access_token"
-)
-
 // WebexAPIClient is a convenience wrapper that will be used to make API calls to the Webex API.
 // It holds the client_id, client_secret, redirect_uri, and access_token required for API calls.
-// Values are also bound to the client and saved as a cookie.
+// Values are also bound to the client and saved server-side as the credentials of the user, without the client secret
+// which is looked up from the registered integration.
 type WebexAPIClient struct {
-	ClientID     string             `json:"client_id"`
-	ClientSecret string             `json:"client_secret"`
-	RedirectURI  string             `json:"redirect_uri"`
-	Auth         types.AuthResponse `json:"auth"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"-"`
+	RedirectURI  string `json:"redirect_uri"`
+	// PersonID is the Webex user who authorized the client, the data fetched with it is kept per user.
+	PersonID string             `json:"person_id"`
+	Auth     types.AuthResponse `json:"auth"`
+	// IssuedAt is when the access token of Auth was issued, its lifetime is counted from it.
+	IssuedAt time.Time `json:"issued_at"`
+	// RefreshIssuedAt is when the refresh token of Auth was issued, Webex may keep it across refreshes.
+	// Sessions saved before it existed lack it, the refresh token is then counted from IssuedAt.
+	RefreshIssuedAt time.Time `json:"refresh_issued_at,omitempty"`
+	// Options are not part of the session, they are set by the server for every request.
+	Options ClientOptions `json:"-"`
+
+	// onRefresh is called once the tokens have been refreshed, e.g. to save them to the session.
+	onRefresh func(*WebexAPIClient) error
 }
 
 // When the user successfully authorizes the application, the OAuth code is retrieved from the redirect handler and
 // used in creating the WebexAPIClient.
-func NewWebexAPIClient(OAuthCode, clientID, clientSecret, redirectURI string) (*WebexAPIClient, error) {
+func NewWebexAPIClient(opts ClientOptions, OAuthCode, clientID, clientSecret, redirectURI string) (*WebexAPIClient, error) {
+	return NewWebexAPIClientContext(context.Background(), opts, OAuthCode, clientID, clientSecret, redirectURI)
+}
+
+// NewWebexAPIClientContext is like NewWebexAPIClient, the token request is cancelled when ctx is done.
+func NewWebexAPIClientContext(ctx context.Context, opts ClientOptions, OAuthCode, clientID, clientSecret, redirectURI string) (*WebexAPIClient, error) {
+	return NewWebexAPIClientPKCE(ctx, opts, OAuthCode, "", clientID, clientSecret, redirectURI)
+}
+
+// NewWebexAPIClientPKCE is like NewWebexAPIClientContext for an OAuth code requested with a PKCE code challenge,
+// codeVerifier is the secret the challenge was derived from. It is not sent when empty.
+func NewWebexAPIClientPKCE(ctx context.Context, opts ClientOptions, OAuthCode, codeVerifier, clientID, clientSecret, redirectURI string) (*WebexAPIClient, error) {
 	// using data form-urlencoded
 	data := url.Values{}
 	data.Add("grant_type", "authorization_code")
@@ -42,29 +61,28 @@ func NewWebexAPIClient(OAuthCode, clientID, clientSecret, redirectURI string) (*
 	data.Add("client_id", clientID)
 	data.Add("client_secret", clientSecret)
 	data.Add("redirect_uri", redirectURI)
-
-	// retrive the access token using the OAuth code to verify the user's identity
-	req, err := http.NewRequest(http.MethodPost, TOKEN_URL, strings.NewReader(data.Encode()))
-	if err != nil {
-		return nil, err
+	if codeVerifier != "" {
+		data.Add("code_verifier", codeVerifier)
 	}
-	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	req.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
 
-	resp, err := http.DefaultClient.Do(req)
+	// retrive the access token using the OAuth code to verify the user's identity
+	resp, err := opts.doOnce(ctx, func() (*http.Request, error) {
+		req, err := opts.newRequest(ctx, http.MethodPost, opts.TokenURL(), strings.NewReader(data.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Content-Length", strconv.Itoa(len(data.Encode())))
+		return req, nil
+	})
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// when the OAuth provide is invalid, the response will be a 401 error
-	if resp.StatusCode == http.StatusUnauthorized {
-		var errResponse types.HTTP4XXError
-		if json.NewDecoder(resp.Body).Decode(&errResponse); err != nil {
-			return nil, err
-		}
-
-		return nil, fmt.Errorf("%s: %s", errResponse.Message, errResponse.Errors[0].Description)
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError(resp)
 	}
 
 	// parse the response body
@@ -73,83 +91,77 @@ func NewWebexAPIClient(OAuthCode, clientID, clientSecret, redirectURI string) (*
 		return nil, err
 	}
 
-	return &WebexAPIClient{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		RedirectURI:  redirectURI,
-		Auth:         authResp,
-	}, nil
-}
-
-// ListMeeting lists all meetings that are accessible to the client account.
-func (c *WebexAPIClient) ListMeetings(tries int) (*types.MeetingsList, error) {
-	if tries > 3 {
-		return nil, fmt.Errorf("failed to get meetings from API, StatusCode: StatusUnauthorized")
+	issuedAt := time.Now()
+	client := &WebexAPIClient{
+		ClientID:        clientID,
+		ClientSecret:    clientSecret,
+		RedirectURI:     redirectURI,
+		Auth:            authResp,
+		IssuedAt:        issuedAt,
+		RefreshIssuedAt: issuedAt,
+		Options:         opts,
 	}
 
-	req, err := http.NewRequest(http.MethodGet, "https://webexapis.com/v1/meetings", nil)
+	// the user who authorized the integration owns the data fetched with it
+	person, err := client.GetMe(ctx)
 	if err != nil {
 		return nil, err
 	}
+	client.PersonID = person.ID
 
-	now := time.Now()
-	from := now.AddDate(0, 0, -30)
+	return client, nil
+}
 
-	req.URL.RawQuery = (url.Values{
-		"to":          []string{now.Format(time.RFC3339)},
-		"from":        []string{from.Format(time.RFC3339)},
-		"meetingType": []string{"meeting"},
-	}).Encode()
-	req.Header.Add("Authorization", "Bearer "+c.Auth.AccessToken)
+// GetMeetingQualities gets the qualities of a meeting.
+func (c *WebexAPIClient) GetMeetingQualities(db *persist.Persist, meetingID string, tries int) (*types.MeetingQualities, error) {
+	return c.GetMeetingQualitiesContext(context.Background(), db, meetingID, tries)
+}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
+// GetMeetingQualitiesContext is like GetMeetingQualities, the request is cancelled when ctx is done.
+func (c *WebexAPIClient) GetMeetingQualitiesContext(ctx context.Context, db *persist.Persist, meetingID string, tries int) (*types.MeetingQualities, error) {
+	// the caller's authorization is checked before anything is served
+	if err := c.ensureToken(ctx); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-
-	switch resp.StatusCode {
-	case http.StatusOK:
-		{
-			var meetings types.MeetingsList
-			if err := json.NewDecoder(resp.Body).Decode(&meetings); err != nil {
-				return nil, err
-			}
 
-			return &meetings, nil
+	// meeting qualities the user fetched recently are served without asking Webex again.
+	if c.Options.QualitiesCacheTTL > 0 {
+		data, err := db.RetrieveRecentAnalyticsData(c.ClientID, c.PersonID, meetingID, c.Options.QualitiesCacheTTL)
+		if err != nil {
+			return nil, err
+		}
+		if data != nil {
+			return data, nil
 		}
+	}
 
-	case http.StatusUnauthorized:
-		if err = c.refreshToken(); err != nil {
+	resp, err := c.Options.do(ctx, func() (*http.Request, error) {
+		req, err := c.Options.newRequest(ctx, http.MethodGet, c.Options.MeetingQualitiesURL(), nil)
+		if err != nil {
 			return nil, err
 		}
-		return c.ListMeetings(tries + 1)
 
-	case http.StatusNoContent:
-		return nil, nil
-
-	default:
-		return nil, fmt.Errorf("failed to get meetings from API, StatusCode: %s", resp.Status)
-	}
-}
+		req.URL.RawQuery = (url.Values{
+			"meetingId": []string{meetingID},
+		}).Encode()
+		req.Header.Add("Authorization", "Bearer "+c.Auth.AccessToken)
+		return req, nil
+	})
 
-// GetMeetingQualities gets the qualities of a meeting.
-func (c *WebexAPIClient) GetMeetingQualities(db *persist.Persist, meetingID string, tries int) (*types.MeetingQualities, error) {
-	if tries > 3 {
-		return nil, fmt.Errorf("failed to get meeting quality from API, StatusCode: StatusUnauthorized")
-	}
+	// the rate limit of 1 request per 5 minutes is hit, retrieve meeting qualities from persitance storage.
+	var rateLimited *RateLimitedError
+	if errors.As(err, &rateLimited) {
+		data, err := db.RetriveAnalyticsData(c.ClientID, c.PersonID, meetingID)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			// data was never persisted due to error in the parsing process
+			return nil, rateLimited
+		}
 
-	req, err := http.NewRequest(http.MethodGet, "https://analytics.webexapis.com/v1/meeting/qualities", nil)
-	if err != nil {
-		return nil, err
+		return data, nil
 	}
-
-	req.URL.RawQuery = (url.Values{
-		"meetingId": []string{meetingID},
-	}).Encode()
-	req.Header.Add("Authorization", "Bearer "+c.Auth.AccessToken)
-
-	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -168,41 +180,70 @@ func (c *WebexAPIClient) GetMeetingQualities(db *persist.Persist, meetingID stri
 		}
 
 		// if the meeting qualities fetch was a success and decoding was successful, persist to db
-		if err := db.SaveAnalyticsData(meetingID, c.ClientID, string(buf)); err != nil {
+		if err := db.SaveAnalyticsData(meetingID, c.ClientID, c.PersonID, string(buf)); err != nil {
 			log.Printf("error on SaveAnalyticsData(): %s\n", err.Error())
 		}
 
 		return &meetingQualities, nil
 
-	case http.StatusTooManyRequests: // this StatusCode is hit when the rate limit of 1 request per 5 minutes is hit
-		// retrieve meeting qualities from persitance storage.
-		data, err := db.RetriveAnalyticsData(c.ClientID, meetingID)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				// data was never persisted due to error in the parsing process
-				return nil, fmt.Errorf("failed to get meeting qualities from API, StatusCode: %s, try after 5 min", resp.Status)
-			}
-			return nil, err
-		}
-
-		return data, nil
-
 	case http.StatusUnauthorized:
-		if err = c.refreshToken(); err != nil {
+		if tries >= 3 {
+			return nil, newAPIError(resp)
+		}
+		if err = c.refreshToken(ctx); err != nil {
 			return nil, err
 		}
-		return c.GetMeetingQualities(db, meetingID, tries+1)
+		return c.GetMeetingQualitiesContext(ctx, db, meetingID, tries+1)
 
 	case http.StatusNoContent:
 		return nil, nil
 
 	default:
-		return nil, fmt.Errorf("failed to get meeting qualities from API, StatusCode: %s", resp.Status)
+		return nil, newAPIError(resp)
 	}
 }
 
 // When the access_token expires or is invalid, the refresh token is used to generate a new access token.
-func (c *WebexAPIClient) refreshToken() error {
+// Concurrent refreshes of the same refresh token are serialized and share the new access token.
+func (c *WebexAPIClient) refreshToken(ctx context.Context) error {
+	if expiresAt := c.RefreshTokenExpiresAt(); !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return ErrRefreshTokenExpired
+	}
+
+	authResp, issuedAt, err := refreshes.do(ctx, c.Auth.RefreshToken, func() (types.AuthResponse, error) {
+		return c.requestRefresh(ctx)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Webex may keep the refresh token as is, its lifetime is still counted from when it was issued
+	refreshIssuedAt := issuedAt
+	if authResp.RefreshToken == "" {
+		authResp.RefreshToken = c.Auth.RefreshToken
+		authResp.RefreshTokenExpiresIn = c.Auth.RefreshTokenExpiresIn
+		refreshIssuedAt = c.refreshIssuedAt()
+	}
+
+	// the granted scopes are kept when Webex does not repeat them
+	if authResp.Scope == "" {
+		authResp.Scope = c.Auth.Scope
+	}
+
+	// update the client
+	c.Auth = authResp
+	c.IssuedAt = issuedAt
+	c.RefreshIssuedAt = refreshIssuedAt
+	if c.onRefresh != nil {
+		if err := c.onRefresh(c); err != nil {
+			log.Printf("error on saving the refreshed token: %s\n", err.Error())
+		}
+	}
+	return nil
+}
+
+// requestRefresh exchanges the refresh token for a new access token.
+func (c *WebexAPIClient) requestRefresh(ctx context.Context) (types.AuthResponse, error) {
 	data, err := json.Marshal(types.RefreshTokenRequest{
 		GrantType:    "refresh_token",
 		ClientID:     c.ClientID,
@@ -210,37 +251,31 @@ func (c *WebexAPIClient) refreshToken() error {
 		RefreshToken: c.Auth.RefreshToken,
 	})
 	if err != nil {
-		return err
-	}
-
-	req, err := http.NewRequest(http.MethodPost, TOKEN_URL, bytes.NewBuffer(data))
-	if err != nil {
-		return err
+		return types.AuthResponse{}, err
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := c.Options.doOnce(ctx, func() (*http.Request, error) {
+		return c.Options.newRequest(ctx, http.MethodPost, c.Options.TokenURL(), bytes.NewReader(data))
+	})
 	if err != nil {
-		return err
+		return types.AuthResponse{}, err
 	}
 	defer resp.Body.Close()
 
 	// when the refresh token is expired, the response will be a 400 error
-	if resp.StatusCode == http.StatusBadRequest {
-		var errResponse types.HTTP4XXError
-		if json.NewDecoder(resp.Body).Decode(&errResponse); err != nil {
-			return err
+	if resp.StatusCode != http.StatusOK {
+		apiErr := newAPIError(resp)
+		if resp.StatusCode == http.StatusBadRequest {
+			apiErr.Err = ErrRefreshTokenExpired
 		}
-
-		return fmt.Errorf("%s: %s", errResponse.Message, errResponse.Errors[0].Description)
+		return types.AuthResponse{}, apiErr
 	}
 
 	// parse the response body
 	var authResp types.AuthResponse
 	if err := json.NewDecoder(resp.Body).Decode(&authResp); err != nil {
-		return err
+		return types.AuthResponse{}, err
 	}
 
-	// update the client
-	c.Auth = authResp
-	return nil
+	return authResp, nil
 }
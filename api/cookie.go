@@ -0,0 +1,267 @@
+package api
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCookie is returned when a cookie was not sealed by the server or was tampered with.
+var ErrInvalidCookie = errors.New("invalid cookie, start the authentication flow again")
+
+// ErrExpiredCookie is returned when a cookie is past the max age it was sealed with.
+var ErrExpiredCookie = errors.New("expired cookie, start the authentication flow again")
+
+// CookieKey is an AES key cookies are sealed with.
+type CookieKey struct {
+	// ID is written in every cookie sealed with the key, so the key can be found again after a rotation.
+	ID string
+	// Key is a 16, 24 or 32 bytes AES key.
+	Key []byte
+	// ExpiresAt is when the key stops being accepted, the zero time if it never does.
+	// A retired key is given an expiry to leave the cookies sealed with it time to be replaced.
+	ExpiresAt time.Time
+}
+
+// CookieCodec seals the values of the cookies set by the server with AES-GCM,
+// so they can neither be read nor forged by the browser.
+//
+// The first key seals new cookies, the others only open the cookies sealed before a rotation.
+// A sealed cookie is "<key ID>.<base64 of nonce|ciphertext>", the cookie name is authenticated along
+// with the value so a cookie cannot be replayed under another name.
+type CookieCodec struct {
+	keys  []cookieKey
+	clock func() time.Time
+}
+
+type cookieKey struct {
+	CookieKey
+	aead cipher.AEAD
+}
+
+// NewCookieCodec creates a codec sealing cookies with the first key.
+func NewCookieCodec(keys ...CookieKey) (*CookieCodec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one cookie key is required")
+	}
+
+	codec := &CookieCodec{clock: time.Now}
+	for _, key := range keys {
+		if key.ID == "" || strings.ContainsAny(key.ID, ".:,; \t") {
+			return nil, fmt.Errorf("invalid cookie key ID %q", key.ID)
+		}
+		for _, k := range codec.keys {
+			if k.ID == key.ID {
+				return nil, fmt.Errorf("duplicate cookie key ID %q", key.ID)
+			}
+		}
+
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("cookie key %q: %w", key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("cookie key %q: %w", key.ID, err)
+		}
+		codec.keys = append(codec.keys, cookieKey{CookieKey: key, aead: aead})
+	}
+
+	return codec, nil
+}
+
+// LoadCookieCodec creates a codec from the keys, or else from the keys of the file, see ParseCookieKeys for their format.
+// When neither is set a random key is generated, the cookies are then lost on restart.
+func LoadCookieCodec(keys []string, keyFile string) (*CookieCodec, error) {
+	if len(keys) > 0 {
+		cookieKeys, err := ParseCookieKeys(strings.Join(keys, ","))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cookie keys: %w", err)
+		}
+		return NewCookieCodec(cookieKeys...)
+	}
+
+	if keyFile != "" {
+		cookieKeys, err := ReadCookieKeyFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return NewCookieCodec(cookieKeys...)
+	}
+
+	log.Println("warning: no cookie key is configured, cookies are sealed with a random key lost on restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return NewCookieCodec(CookieKey{ID: "ephemeral", Key: key})
+}
+
+// ParseCookieKeys parses a comma or newline separated list of "<ID>:<base64 key>[:<expiry>]" entries,
+// the expiry being an RFC 3339 timestamp or a date. Blank lines and lines starting with # are ignored.
+//
+//	COOKIE_KEYS="2024-06:q7n...=,2024-01:Zx1...=:2024-07-01"
+func ParseCookieKeys(value string) ([]CookieKey, error) {
+	keys := []CookieKey{}
+	for _, entry := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf(`cookie key entry %q is not "<ID>:<base64 key>"`, redact(entry))
+		}
+
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("cookie key %q is not base64", parts[0])
+		}
+
+		cookieKey := CookieKey{ID: parts[0], Key: key}
+		if len(parts) == 3 {
+			if cookieKey.ExpiresAt, err = parseQueryTime(parts[2]); err != nil {
+				return nil, fmt.Errorf("cookie key %q has an invalid expiry %q", parts[0], parts[2])
+			}
+		}
+		keys = append(keys, cookieKey)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("no cookie key")
+	}
+	return keys, nil
+}
+
+// ReadCookieKeyFile reads the keys of the file, one entry per line in the format of ParseCookieKeys.
+func ReadCookieKeyFile(path string) ([]CookieKey, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	keys, err := ParseCookieKeys(strings.Join(lines, "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cookie key file %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// redact hides the key of a malformed entry in error messages.
+func redact(entry string) string {
+	if id, _, found := strings.Cut(entry, ":"); found {
+		return id + ":..."
+	}
+	return "..."
+}
+
+// Encode seals v, encoded as JSON, for the cookie name. The sealed value is rejected once maxAge has elapsed.
+func (c *CookieCodec) Encode(name string, v interface{}, maxAge time.Duration) (string, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+
+	key := c.keys[0]
+	if !key.ExpiresAt.IsZero() && !c.clock().Before(key.ExpiresAt) {
+		return "", fmt.Errorf("cookie key %q has expired, add a new key first", key.ID)
+	}
+
+	// the expiry is sealed along with the value
+	plaintext := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint64(plaintext, uint64(c.clock().Add(maxAge).Unix()))
+	plaintext = append(plaintext, payload...)
+
+	nonce := make([]byte, key.aead.NonceSize(), key.aead.NonceSize()+len(plaintext)+key.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := key.aead.Seal(nonce, nonce, plaintext, []byte(name))
+
+	return key.ID + "." + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decode opens the value sealed by Encode for the cookie name into v.
+// ErrInvalidCookie is returned when the value was tampered with, sealed for another cookie or with an unknown
+// or expired key, ErrExpiredCookie when its max age has elapsed.
+func (c *CookieCodec) Decode(name, value string, v interface{}) error {
+	id, encoded, found := strings.Cut(value, ".")
+	if !found {
+		return ErrInvalidCookie
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidCookie
+	}
+
+	now := c.clock()
+	for _, key := range c.keys {
+		if key.ID != id {
+			continue
+		}
+		if !key.ExpiresAt.IsZero() && !now.Before(key.ExpiresAt) {
+			return ErrInvalidCookie
+		}
+		if len(sealed) < key.aead.NonceSize() {
+			return ErrInvalidCookie
+		}
+
+		nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+		plaintext, err := key.aead.Open(nil, nonce, ciphertext, []byte(name))
+		if err != nil || len(plaintext) < 8 {
+			return ErrInvalidCookie
+		}
+
+		if expiresAt := time.Unix(int64(binary.BigEndian.Uint64(plaintext)), 0); !now.Before(expiresAt) {
+			return ErrExpiredCookie
+		}
+		return json.Unmarshal(plaintext[8:], v)
+	}
+
+	return ErrInvalidCookie
+}
+
+// setCookie seals v in the cookie, the browser drops it once maxAge has elapsed.
+func (c *CookieCodec) setCookie(w http.ResponseWriter, cookie *http.Cookie, v interface{}, maxAge time.Duration) error {
+	value, err := c.Encode(cookie.Name, v, maxAge)
+	if err != nil {
+		return err
+	}
+
+	cookie.Value = value
+	cookie.MaxAge = int(maxAge.Seconds())
+	http.SetCookie(w, cookie)
+	return nil
+}
+
+// readCookie opens the cookie of the request into v.
+func (c *CookieCodec) readCookie(r *http.Request, name string, v interface{}) error {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return err
+	}
+	return c.Decode(name, cookie.Value, v)
+}
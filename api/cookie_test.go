@@ -0,0 +1,287 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+func testCookieKey(id string, b byte) CookieKey {
+	return CookieKey{ID: id, Key: bytes.Repeat([]byte{b}, 32)}
+}
+
+func newTestCookieCodec(t *testing.T, now *time.Time, keys ...CookieKey) *CookieCodec {
+	t.Helper()
+
+	codec, err := NewCookieCodec(keys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codec.clock = func() time.Time { return *now }
+	return codec
+}
+
+func TestCookieCodecRoundTrip(t *testing.T) {
+	now := time.Now()
+	codec := newTestCookieCodec(t, &now, testCookieKey("k1", 1))
+
+	data := types.OAuthRequest{
+		ClientID:     "clientID",
+		Scope:        "analytics:read_all",
+		CodeVerifier: "codeVerifier",
+	}
+	value, err := codec.Encode("OAuthRequest", data, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(value, "codeVerifier") || strings.Contains(value, base64.StdEncoding.EncodeToString([]byte("codeVerifier"))) {
+		t.Errorf("sealed cookie leaks the code verifier: %s", value)
+	}
+	if !strings.HasPrefix(value, "k1.") {
+		t.Errorf("want the key ID in the sealed cookie, got %s", value)
+	}
+
+	var got types.OAuthRequest
+	if err := codec.Decode("OAuthRequest", value, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, got) {
+		t.Errorf("want %+v, got %+v", data, got)
+	}
+
+	// every value is sealed with its own nonce
+	if again, _ := codec.Encode("OAuthRequest", data, time.Minute); again == value {
+		t.Error("want distinct sealed values for the same data")
+	}
+}
+
+func TestCookieCodecTampering(t *testing.T) {
+	now := time.Now()
+	codec := newTestCookieCodec(t, &now, testCookieKey("k1", 1))
+
+	value, err := codec.Encode("OAuthRequest", types.OAuthRequest{ClientID: "clientID"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, encoded, _ := strings.Cut(value, ".")
+	sealed, _ := base64.RawURLEncoding.DecodeString(encoded)
+
+	flipped := append([]byte{}, sealed...)
+	flipped[len(flipped)-1] ^= 1
+
+	forged, err := NewCookieCodec(testCookieKey("k1", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedValue, err := forged.Encode("OAuthRequest", types.OAuthRequest{ClientID: "attacker"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		cookie string
+		value  string
+	}{
+		{name: "flipped bit", cookie: "OAuthRequest", value: id + "." + base64.RawURLEncoding.EncodeToString(flipped)},
+		{name: "truncated", cookie: "OAuthRequest", value: id + "." + base64.RawURLEncoding.EncodeToString(sealed[:8])},
+		{name: "unsealed base64", cookie: "OAuthRequest", value: base64.StdEncoding.EncodeToString([]byte(`{"client_id":"attacker"}`))},
+		{name: "not base64", cookie: "OAuthRequest", value: id + ".!!!"},
+		{name: "unknown key ID", cookie: "OAuthRequest", value: "k2." + encoded},
+		{name: "other cookie name", cookie: SESSION_COOKIE, value: value},
+		{name: "forged with another key", cookie: "OAuthRequest", value: forgedValue},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got types.OAuthRequest
+			if err := codec.Decode(test.cookie, test.value, &got); !errors.Is(err, ErrInvalidCookie) {
+				t.Errorf("want ErrInvalidCookie, got %v with %+v", err, got)
+			}
+		})
+	}
+}
+
+func TestCookieCodecMaxAge(t *testing.T) {
+	now := time.Now()
+	codec := newTestCookieCodec(t, &now, testCookieKey("k1", 1))
+
+	value, err := codec.Encode(SESSION_COOKIE, "session", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	var got string
+	if err := codec.Decode(SESSION_COOKIE, value, &got); !errors.Is(err, ErrExpiredCookie) {
+		t.Errorf("want ErrExpiredCookie, got %v", err)
+	}
+}
+
+func TestCookieCodecRotation(t *testing.T) {
+	now := time.Now()
+	old := newTestCookieCodec(t, &now, testCookieKey("old", 1))
+	sealedWithOld, err := old.Encode(SESSION_COOKIE, "before rotation", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the new key is added first, the old one is kept to open the cookies sealed before the rotation
+	retired := testCookieKey("old", 1)
+	retired.ExpiresAt = now.Add(10 * time.Minute)
+	rotated := newTestCookieCodec(t, &now, testCookieKey("new", 2), retired)
+
+	var got string
+	if err := rotated.Decode(SESSION_COOKIE, sealedWithOld, &got); err != nil || got != "before rotation" {
+		t.Fatalf("want the old cookie opened after the rotation, got %q, %v", got, err)
+	}
+
+	sealedWithNew, err := rotated.Encode(SESSION_COOKIE, "after rotation", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealedWithNew, "new.") {
+		t.Errorf("want new cookies sealed with the new key, got %s", sealedWithNew)
+	}
+	if err := old.Decode(SESSION_COOKIE, sealedWithNew, &got); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("want the old codec to reject the new key, got %v", err)
+	}
+
+	// once the retired key expires, the cookies sealed with it are rejected
+	now = now.Add(time.Hour - time.Minute)
+	if err := rotated.Decode(SESSION_COOKIE, sealedWithOld, &got); !errors.Is(err, ErrInvalidCookie) {
+		t.Errorf("want ErrInvalidCookie with an expired key, got %v", err)
+	}
+	if err := rotated.Decode(SESSION_COOKIE, sealedWithNew, &got); err != nil || got != "after rotation" {
+		t.Errorf("want the new cookie opened, got %q, %v", got, err)
+	}
+}
+
+func TestCookieCodecExpiredKey(t *testing.T) {
+	now := time.Now()
+	key := testCookieKey("k1", 1)
+	key.ExpiresAt = now.Add(-time.Second)
+	codec := newTestCookieCodec(t, &now, key)
+
+	if _, err := codec.Encode(SESSION_COOKIE, "session", time.Minute); err == nil {
+		t.Error("want an error sealing with an expired key")
+	}
+}
+
+func TestNewCookieCodecInvalidKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		keys []CookieKey
+	}{
+		{name: "no key"},
+		{name: "short key", keys: []CookieKey{{ID: "k1", Key: []byte("short")}}},
+		{name: "empty ID", keys: []CookieKey{testCookieKey("", 1)}},
+		{name: "ID with a dot", keys: []CookieKey{testCookieKey("k.1", 1)}},
+		{name: "duplicate ID", keys: []CookieKey{testCookieKey("k1", 1), testCookieKey("k1", 2)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := NewCookieCodec(test.keys...); err == nil {
+				t.Error("want an error")
+			}
+		})
+	}
+}
+
+func TestParseCookieKeys(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	k2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 16))
+
+	keys, err := ParseCookieKeys("new:" + k1 + ", old:" + k2 + ":2024-07-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].ID != "new" || keys[1].ID != "old" {
+		t.Fatalf("unexpected keys %+v", keys)
+	}
+	if !keys[0].ExpiresAt.IsZero() || !keys[1].ExpiresAt.Equal(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected expiries %s, %s", keys[0].ExpiresAt, keys[1].ExpiresAt)
+	}
+
+	for _, invalid := range []string{"", "nokey", "k1:not base64", "k1:" + k1 + ":someday"} {
+		if _, err := ParseCookieKeys(invalid); err == nil {
+			t.Errorf("want an error for %q", invalid)
+		}
+	}
+
+	// the key is never part of the error
+	if _, err := ParseCookieKeys(k1); err == nil || strings.Contains(err.Error(), k1) {
+		t.Errorf("want an error without the key, got %v", err)
+	}
+}
+
+func TestLoadCookieCodec(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32))
+	k2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{2}, 32))
+
+	path := filepath.Join(t.TempDir(), "cookie.keys")
+	if err := os.WriteFile(path, []byte("# rotated 2024-06\nfile:"+k2+"\n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	codec, err := LoadCookieCodec([]string{"new:" + k1, "old:" + k2}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codec.keys) != 2 || codec.keys[0].ID != "new" {
+		t.Errorf("want the keys in order, got %+v", codec.keys)
+	}
+
+	if codec, err = LoadCookieCodec(nil, path); err != nil {
+		t.Fatal(err)
+	}
+	if codec.keys[0].ID != "file" {
+		t.Errorf("want the key of the file, got key %q", codec.keys[0].ID)
+	}
+
+	if codec, err = LoadCookieCodec(nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if len(codec.keys) != 1 || len(codec.keys[0].Key) != 32 {
+		t.Errorf("want a random key, got %+v", codec.keys)
+	}
+}
+
+func TestTamperedOAuthRequestCookie(t *testing.T) {
+	app := newTestApp(t)
+
+	// a forged OAuth request, as the unsealed cookies could be
+	forged, err := NewCookieCodec(testCookieKey("test", 9))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := forged.Encode(OAUTH_REQUEST_COOKIE, types.OAuthRequest{ClientID: testClientID, State: "forged"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, app.server.URL+"/auth?code="+app.webex.IssueCode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.AddCookie(&http.Cookie{Name: OAUTH_REQUEST_COOKIE, Value: value})
+	resp, err := app.browser.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := readBody(t, resp)
+
+	if resp.Request.URL.Path != "/error" || !strings.Contains(body, ErrInvalidCookie.Error()) {
+		t.Errorf("want the error page, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+
+	"Webex.API.Integration.And.Visualization/persist"
+)
+
+// credentialStore keeps the Webex authorization every user granted to every integration server-side.
+// It is the single record the sessions and the personal access tokens of the user refer to, so a refresh made
+// through any of them is seen by all. The client secret is not part of it, it is looked up from the registered
+// integration when the credentials are loaded.
+type credentialStore struct {
+	db *persist.Persist
+}
+
+// save stores the client as the credentials of its user for its integration, replacing the previous ones.
+func (s *credentialStore) save(client *WebexAPIClient) error {
+	data, err := json.Marshal(client)
+	if err != nil {
+		return err
+	}
+
+	return s.db.SaveCredentials(client.ClientID, client.PersonID, string(data))
+}
+
+// load retrieves the client of the user for the integration, it is nil if the user never authorized it.
+// Token refreshes made by the client are saved back to the credentials.
+func (s *credentialStore) load(clientID, personID string) (*WebexAPIClient, error) {
+	data, err := s.db.RetrieveCredentials(clientID, personID)
+	if err != nil {
+		return nil, err
+	}
+	if data == "" {
+		return nil, nil
+	}
+
+	var client WebexAPIClient
+	if err := json.Unmarshal([]byte(data), &client); err != nil {
+		return nil, err
+	}
+
+	// the secret is only kept with the integration, which may have been unregistered since
+	integration, err := lookupIntegration(s.db, clientID)
+	if err != nil {
+		return nil, err
+	}
+	client.ClientSecret = integration.ClientSecret
+
+	client.onRefresh = s.save
+	return &client, nil
+}
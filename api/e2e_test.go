@@ -0,0 +1,584 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"html"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"Webex.API.Integration.And.Visualization/persist"
+	"Webex.API.Integration.And.Visualization/types"
+	"Webex.API.Integration.And.Visualization/webextest"
+)
+
+const (
+	testClientID     = "test-client-id"
+	testClientSecret = "test-client-secret"
+)
+
+// testApp is the application wired to a fake Webex API.
+type testApp struct {
+	webex    *webextest.Server
+	server   *httptest.Server
+	browser  *http.Client
+	db       *persist.Persist
+	sessions *sessionStore
+	tokens   *tokenStore
+	opts     ClientOptions
+}
+
+// newTestApp starts the server against a fake Webex, configure may change the client options of the server.
+func newTestApp(t *testing.T, configure ...func(*ClientOptions)) *testApp {
+	t.Helper()
+
+	webex := webextest.NewServer(testClientID, testClientSecret, 1)
+	t.Cleanup(webex.Close)
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "webex.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	p, err := persist.NewPersist(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.SaveIntegration(types.Integration{
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		Scopes:       DEFAULT_SCOPES,
+		Label:        "Test integration",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := ClientOptions{
+		BaseURL:          webex.BaseURL(),
+		AnalyticsBaseURL: webex.AnalyticsBaseURL(),
+		Retry: RetryPolicy{
+			MaxAttempts: 3,
+			BaseDelay:   time.Millisecond,
+			MaxDelay:    5 * time.Millisecond,
+			MaxWait:     time.Second,
+		},
+	}
+	for _, c := range configure {
+		c(&opts)
+	}
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	host := server.URL
+	codec, err := NewCookieCodec(CookieKey{ID: "test", Key: make([]byte, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions := newSessionStore(p, host, DEFAULT_SESSION_TTL, codec)
+
+	// the server is wired with the test options instead of being loaded from a configuration
+	pages, err := newPageTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := newTokenStore(p)
+	app := &Server{db: p, host: host, opts: opts, codec: codec, sessions: sessions, tokens: tokens, features: FEATURES, pages: pages, mux: mux}
+	app.routes()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testApp{
+		webex:    webex,
+		server:   server,
+		browser:  &http.Client{Jar: jar},
+		db:       p,
+		sessions: sessions,
+		tokens:   tokens,
+		opts:     opts,
+	}
+}
+
+// login runs the OAuth flow in the browser, following the redirects through the fake Webex.
+func (a *testApp) login(t *testing.T) {
+	t.Helper()
+
+	resp, err := a.browser.PostForm(a.server.URL+"/init", url.Values{
+		"integration": {testClientID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := readBody(t, resp)
+
+	if resp.Request.URL.Path != "/message" || !strings.Contains(body, "Successfully authenticated") {
+		t.Fatalf("OAuth flow ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func (a *testApp) get(t *testing.T, path string) (*http.Response, string) {
+	t.Helper()
+
+	resp, err := a.browser.Get(a.server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, readBody(t, resp)
+}
+
+// client creates a WebexAPIClient authorized against the fake Webex.
+func (a *testApp) client(t *testing.T) *WebexAPIClient {
+	t.Helper()
+
+	client, err := NewWebexAPIClient(a.opts, a.webex.IssueCode(), testClientID, testClientSecret, a.server.URL+"/auth")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	defer resp.Body.Close()
+	buf, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(buf)
+}
+
+func TestOAuthMeetingsAnalyticsFlow(t *testing.T) {
+	app := newTestApp(t)
+	meetings := app.webex.AddMeetings(3)
+
+	app.login(t)
+
+	resp, body := app.get(t, "/get_meetings_page")
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/get_meetings_page" {
+		t.Fatalf("get meetings ended at %s with status %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	for _, meeting := range meetings {
+		if !strings.Contains(body, html.EscapeString(meeting.Title)) {
+			t.Errorf("meetings page does not list %q", meeting.Title)
+		}
+	}
+
+	resp, body = app.get(t, "/get_analytics_page?id="+meetings[0].ID+"&dp=video_in")
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/get_analytics_page" {
+		t.Fatalf("get analytics ended at %s with status %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	if !strings.Contains(body, meetings[0].ID) {
+		t.Errorf("analytics page does not mention meeting %s", meetings[0].ID)
+	}
+	if !strings.Contains(body, `id="participants"`) || !strings.Contains(body, `"participants":[{`) {
+		t.Errorf("analytics page does not break the data down by participant")
+	}
+	if !strings.Contains(body, `id="cpu"`) || !strings.Contains(body, `"system_average_cpu":[{`) {
+		t.Errorf("analytics page does not carry the CPU usage of the devices")
+	}
+
+	resp, body = app.get(t, "/get_analytics_page?id="+meetings[0].ID+"&dp=resources")
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/get_analytics_page" {
+		t.Fatalf("get resources ended at %s with status %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	if !strings.Contains(body, "Data for Resources") || strings.Contains(body, `id="cpu"`) {
+		t.Errorf("resources page does not chart the CPU usage on its own")
+	}
+
+	resp, body = app.get(t, "/get_analytics_file?id="+meetings[1].ID)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get analytics file: status %d: %s", resp.StatusCode, body)
+	}
+	var file struct {
+		Analytics []types.VisualData `json:"analytics"`
+	}
+	if err := json.Unmarshal([]byte(body), &file); err != nil {
+		t.Fatalf("analytics file is not JSON: %v", err)
+	}
+	if len(file.Analytics) != 7 {
+		t.Fatalf("want 7 data points in analytics file, got %d", len(file.Analytics))
+	}
+	for _, vd := range file.Analytics {
+		if vd.MeetingID != meetings[1].ID {
+			t.Errorf("want meeting ID %s, got %s", meetings[1].ID, vd.MeetingID)
+		}
+		if vd.DataPoint != "video_in" {
+			continue
+		}
+		for _, participant := range vd.Participants {
+			for _, session := range participant.Sessions {
+				if len(session.MediaBitRate) == 0 || len(session.ResolutionHeight) == 0 || len(session.FrameRate) == 0 || len(session.Changes) == 0 {
+					t.Errorf("want the bit rate, resolution, frame rate and codec of the video of %s", participant.Key)
+				}
+			}
+		}
+	}
+}
+
+func TestPagesRequireAuthentication(t *testing.T) {
+	app := newTestApp(t)
+
+	resp, body := app.get(t, "/get_meetings_page")
+	if resp.Request.URL.Path != "/error" || !strings.Contains(body, "Complete the authentication flow.") {
+		t.Fatalf("want redirect to error page, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func TestNewWebexAPIClientInvalidCode(t *testing.T) {
+	app := newTestApp(t)
+
+	_, err := NewWebexAPIClient(app.opts, "not-a-code", testClientID, testClientSecret, app.server.URL+"/auth")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("want 401 APIError for invalid OAuth code, got %v", err)
+	}
+}
+
+func TestGetMeetingQualities(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	client := app.client(t)
+
+	t.Run("success is persisted", func(t *testing.T) {
+		got, err := client.GetMeetingQualities(app.db, meeting.ID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := app.webex.Qualities(meeting.ID); !reflect.DeepEqual(want.MediaSessions, got.MediaSessions) {
+			t.Error("qualities differ from the ones served")
+		}
+
+		persisted, err := app.db.RetriveAnalyticsData(testClientID, webextest.DEFAULT_PERSON_ID, meeting.ID)
+		if err != nil || persisted == nil {
+			t.Fatalf("qualities were not persisted: %v", err)
+		}
+	})
+
+	t.Run("401 refreshes the access token", func(t *testing.T) {
+		app.webex.ExpireAccessTokens()
+		refreshes := app.webex.Calls("/v1/access_token")
+
+		if _, err := client.GetMeetingQualities(app.db, meeting.ID, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got := app.webex.Calls("/v1/access_token"); got != refreshes+1 {
+			t.Errorf("want 1 token refresh, got %d", got-refreshes)
+		}
+	})
+
+	t.Run("429 falls back to persisted qualities", func(t *testing.T) {
+		app.webex.ScriptQualities(meeting.ID, webextest.Response{Status: http.StatusTooManyRequests, RetryAfter: 5 * time.Minute})
+
+		got, err := client.GetMeetingQualities(app.db, meeting.ID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := app.webex.Qualities(meeting.ID); !reflect.DeepEqual(want.MediaSessions, got.MediaSessions) {
+			t.Error("qualities differ from the persisted ones")
+		}
+	})
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		app.webex.ScriptQualities(meeting.ID,
+			webextest.Response{Status: http.StatusServiceUnavailable},
+			webextest.Response{Status: http.StatusTooManyRequests, RetryAfter: time.Millisecond},
+		)
+		calls := app.webex.Calls("/analytics/v1/meeting/qualities")
+
+		if _, err := client.GetMeetingQualities(app.db, meeting.ID, 0); err != nil {
+			t.Fatal(err)
+		}
+		if got := app.webex.Calls("/analytics/v1/meeting/qualities"); got != calls+3 {
+			t.Errorf("want 3 attempts, got %d", got-calls)
+		}
+	})
+
+	t.Run("attempts are capped", func(t *testing.T) {
+		app.webex.ScriptQualities(meeting.ID,
+			webextest.Response{Status: http.StatusBadGateway},
+			webextest.Response{Status: http.StatusBadGateway},
+			webextest.Response{Status: http.StatusBadGateway},
+		)
+
+		_, err := client.GetMeetingQualities(app.db, meeting.ID, 0)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("want APIError once the attempts are exhausted, got %v", err)
+		}
+		if apiErr.StatusCode != http.StatusBadGateway || apiErr.TrackingID == "" {
+			t.Errorf("want 502 with a tracking ID, got %d %q", apiErr.StatusCode, apiErr.TrackingID)
+		}
+	})
+
+	t.Run("204 has no qualities", func(t *testing.T) {
+		app.webex.ScriptQualities(meeting.ID, webextest.Response{Status: http.StatusNoContent})
+
+		got, err := client.GetMeetingQualities(app.db, meeting.ID, 0)
+		if err != nil || got != nil {
+			t.Fatalf("want no qualities and no error, got %v, %v", got, err)
+		}
+	})
+}
+
+func TestGetMeetingQualitiesRateLimited(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	client := app.client(t)
+
+	app.webex.ScriptQualities(meeting.ID, webextest.Response{Status: http.StatusTooManyRequests, RetryAfter: 5 * time.Minute})
+	_, err := client.GetMeetingQualities(app.db, meeting.ID, 0)
+
+	var rateLimited *RateLimitedError
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("want RateLimitedError without persisted qualities, got %v", err)
+	}
+	if d := rateLimited.RetryAfter(); d < 4*time.Minute || d > 5*time.Minute {
+		t.Errorf("want retry after about 5m, got %s", d)
+	}
+	if !strings.Contains(err.Error(), "available in ") {
+		t.Errorf("unexpected message: %s", err)
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.TrackingID == "" {
+		t.Errorf("want the 429 APIError with its tracking ID, got %v", apiErr)
+	}
+	if calls := app.webex.Calls("/analytics/v1/meeting/qualities"); calls != 1 {
+		t.Errorf("want a Retry-After above the wait cap not to be waited for, got %d attempts", calls)
+	}
+}
+
+func TestPersistedQualitiesArePerUser(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	owner := app.client(t)
+	app.webex.SignInAs("other-person")
+	other := app.client(t)
+
+	if owner.PersonID != webextest.DEFAULT_PERSON_ID || other.PersonID != "other-person" {
+		t.Fatalf("want the clients of two users, got %q and %q", owner.PersonID, other.PersonID)
+	}
+	if _, err := owner.GetMeetingQualities(app.db, meeting.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the qualities persisted for a user are not served to another one
+	app.webex.ScriptQualities(meeting.ID, webextest.Response{Status: http.StatusTooManyRequests, RetryAfter: 5 * time.Minute})
+	got, err := other.GetMeetingQualities(app.db, meeting.ID, 0)
+	var rateLimited *RateLimitedError
+	if !errors.As(err, &rateLimited) || got != nil {
+		t.Errorf("want RateLimitedError without the qualities of another user, got %v, %v", got, err)
+	}
+}
+
+func TestListMeetings(t *testing.T) {
+	app := newTestApp(t)
+	client := app.client(t)
+
+	t.Run("no meetings", func(t *testing.T) {
+		got, err := client.ListMeetings(DefaultMeetingQuery())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Items) != 0 {
+			t.Errorf("want no meetings, got %d", len(got.Items))
+		}
+	})
+
+	t.Run("401 refreshes the access token", func(t *testing.T) {
+		want := app.webex.AddMeetings(2)
+		app.webex.ExpireAccessTokens()
+
+		got, err := client.ListMeetings(DefaultMeetingQuery())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(want, got.Items) {
+			t.Errorf("want %d meetings, got %d", len(want), len(got.Items))
+		}
+	})
+
+	t.Run("expired refresh token", func(t *testing.T) {
+		app.webex.ExpireAccessTokens()
+		app.webex.ExpireRefreshTokens()
+
+		_, err := client.ListMeetings(DefaultMeetingQuery())
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+			t.Fatalf("want the 400 APIError of the refresh, got %v", err)
+		}
+		if !errors.Is(err, ErrRefreshTokenExpired) {
+			t.Errorf("want ErrRefreshTokenExpired, got %v", err)
+		}
+	})
+}
+
+func TestListMeetingsPagination(t *testing.T) {
+	app := newTestApp(t)
+	want := app.webex.AddMeetings(25)
+	client := app.client(t)
+
+	query := DefaultMeetingQuery()
+	query.Max = 10
+	got, err := client.ListMeetings(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(want, got.Items) {
+		t.Fatalf("want %d meetings, got %d", len(want), len(got.Items))
+	}
+	if calls := app.webex.Calls("/v1/meetings"); calls != 3 {
+		t.Errorf("want 3 pages fetched, got %d", calls)
+	}
+
+	t.Run("iterator", func(t *testing.T) {
+		var ids []string
+		query.Max = 7
+		it := client.Meetings(query)
+		for it.Next() {
+			ids = append(ids, it.Meeting().ID)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatal(err)
+		}
+		if len(ids) != len(want) {
+			t.Errorf("want %d meetings, got %d", len(want), len(ids))
+		}
+	})
+}
+
+func TestListMeetingsFilters(t *testing.T) {
+	app := newTestApp(t)
+	meetings := app.webex.AddMeetings(5)
+	client := app.client(t)
+
+	query := DefaultMeetingQuery()
+	query.HostEmail = meetings[2].HostEmail
+	got, err := client.ListMeetings(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Items) != 1 || got.Items[0].ID != meetings[2].ID {
+		t.Errorf("want only meeting %s, got %d meetings", meetings[2].ID, len(got.Items))
+	}
+
+	query = DefaultMeetingQuery()
+	query.MeetingType = MEETING_TYPE_SERIES
+	if got, err = client.ListMeetings(query); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Items) != 0 {
+		t.Errorf("want no meeting series, got %d", len(got.Items))
+	}
+
+	app.login(t)
+	resp, body := app.get(t, "/get_meetings_page?meetingNumber="+meetings[4].MeetingNumber)
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/get_meetings_page" {
+		t.Fatalf("get meetings ended at %s with status %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	for i, meeting := range meetings {
+		if listed := strings.Contains(body, meeting.ID); listed != (i == 4) {
+			t.Errorf("meeting %d listed: %v", i, listed)
+		}
+	}
+}
+
+func TestListUpcomingMeetings(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+
+	// only from is set, to follows it rather than now
+	from := time.Now().AddDate(0, 0, 7).UTC().Format(dateTimeLocal)
+	resp, body := app.get(t, "/get_meetings_page?meetingType="+MEETING_TYPE_SCHEDULED+"&from="+from)
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/get_meetings_page" {
+		t.Fatalf("get meetings ended at %s with status %d: %s", resp.Request.URL, resp.StatusCode, body)
+	}
+	if !strings.Contains(body, `name="from" id="from" value="`+from+`"`) || !strings.Contains(body, `name="to" id="to" value=""`) {
+		t.Errorf("want the form to keep from only: %s", body)
+	}
+}
+
+func TestClientContextCancellation(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	client := app.client(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := client.ListMeetingsContext(ctx, DefaultMeetingQuery()); !errors.Is(err, context.Canceled) {
+		t.Errorf("ListMeetingsContext: want context.Canceled, got %v", err)
+	}
+	if _, err := client.GetMeetingQualitiesContext(ctx, app.db, meeting.ID, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("GetMeetingQualitiesContext: want context.Canceled, got %v", err)
+	}
+	if _, err := NewWebexAPIClientContext(ctx, app.opts, app.webex.IssueCode(), testClientID, testClientSecret, app.server.URL+"/auth"); !errors.Is(err, context.Canceled) {
+		t.Errorf("NewWebexAPIClientContext: want context.Canceled, got %v", err)
+	}
+}
+
+func TestGetMeetingQualitiesCache(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	client := app.client(t)
+	client.Options.QualitiesCacheTTL = time.Minute
+
+	for i := 0; i < 2; i++ {
+		got, err := client.GetMeetingQualities(app.db, meeting.ID, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := app.webex.Qualities(meeting.ID); !reflect.DeepEqual(want.MediaSessions, got.MediaSessions) {
+			t.Errorf("unexpected qualities on call %d", i+1)
+		}
+	}
+	if calls := app.webex.Calls("/analytics/v1/meeting/qualities"); calls != 1 {
+		t.Errorf("want the second call served from the cache, got %d requests", calls)
+	}
+
+	// the cache of a user is not served to another one
+	app.webex.SignInAs("other-person")
+	other := app.client(t)
+	other.Options.QualitiesCacheTTL = time.Minute
+	if _, err := other.GetMeetingQualities(app.db, meeting.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if calls := app.webex.Calls("/analytics/v1/meeting/qualities"); calls != 2 {
+		t.Errorf("want Webex asked for another user, got %d requests", calls)
+	}
+
+	// the cache is not served once the user's authorization has expired
+	expired := *client
+	expired.RefreshIssuedAt = time.Now().Add(-time.Duration(client.Auth.RefreshTokenExpiresIn+1) * time.Second)
+	if _, err := expired.GetMeetingQualities(app.db, meeting.ID, 0); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Errorf("want ErrRefreshTokenExpired, got %v", err)
+	}
+
+	// the cache is disabled with a TTL of 0
+	client.Options.QualitiesCacheTTL = 0
+	if _, err := client.GetMeetingQualities(app.db, meeting.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if calls := app.webex.Calls("/analytics/v1/meeting/qualities"); calls != 3 {
+		t.Errorf("want Webex asked again without the cache, got %d requests", calls)
+	}
+}
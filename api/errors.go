@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// APIError is returned by the WebexAPIClient when Webex answers with an unexpected status.
+// It can be retrieved with errors.As, the TrackingID is what Webex support asks for when reporting an issue.
+type APIError struct {
+	// StatusCode and Status are the ones of the Webex response, e.g. 401 and "401 Unauthorized".
+	StatusCode int
+	Status     string
+	// TrackingID identifies the request at Webex.
+	TrackingID string
+	// Message is the message of the error body, if any.
+	Message string
+	// Descriptions are the descriptions of all the errors of the error body.
+	Descriptions []string
+	// Err is the condition the response is interpreted as, e.g. ErrRefreshTokenExpired, it may be nil.
+	Err error
+}
+
+func (e *APIError) Error() string {
+	details := []string{}
+	if e.Message != "" {
+		details = append(details, e.Message)
+	}
+	for _, description := range e.Descriptions {
+		if description != "" && description != e.Message {
+			details = append(details, description)
+		}
+	}
+
+	if len(details) == 0 {
+		return fmt.Sprintf("Webex API error, StatusCode: %s", e.Status)
+	}
+	return fmt.Sprintf("Webex API error, StatusCode: %s: %s", e.Status, strings.Join(details, "; "))
+}
+
+// Unwrap returns the condition the response is interpreted as.
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// newAPIError reads the Webex error body of resp, the body is consumed but not closed.
+func newAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		TrackingID: resp.Header.Get("TrackingID"),
+	}
+
+	var body types.HTTP4XXError
+	buf, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil || json.Unmarshal(buf, &body) != nil {
+		return apiErr
+	}
+
+	apiErr.Message = body.Message
+	for _, e := range body.Errors {
+		apiErr.Descriptions = append(apiErr.Descriptions, e.Description)
+	}
+	if body.TrackingID != "" {
+		apiErr.TrackingID = body.TrackingID
+	}
+
+	return apiErr
+}
+
+// errorMessage is the message displayed to the user for err.
+// The Webex tracking ID is included so it can be handed to Webex support, the error is also logged with it.
+func errorMessage(err error) string {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.TrackingID == "" {
+		return err.Error()
+	}
+
+	log.Printf("Webex API error, trackingId: %s: %s\n", apiErr.TrackingID, err.Error())
+	return fmt.Sprintf("%s (Tracking ID: %s)", err.Error(), apiErr.TrackingID)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		header  string
+		body    string
+		want    APIError
+		wantMsg string
+	}{
+		{
+			name:   "Webex error body",
+			status: http.StatusUnauthorized,
+			body:   `{"message":"The request requires a valid access token.","errors":[{"description":"The request requires a valid access token."},{"description":"Token expired"}],"trackingId":"ROUTER_1"}`,
+			want: APIError{
+				StatusCode:   http.StatusUnauthorized,
+				Status:       "401 Unauthorized",
+				TrackingID:   "ROUTER_1",
+				Message:      "The request requires a valid access token.",
+				Descriptions: []string{"The request requires a valid access token.", "Token expired"},
+			},
+			wantMsg: "Webex API error, StatusCode: 401 Unauthorized: The request requires a valid access token.; Token expired",
+		},
+		{
+			name:   "no errors in body",
+			status: http.StatusBadRequest,
+			body:   `{"message":"Invalid refresh token","trackingId":"ROUTER_2"}`,
+			want: APIError{
+				StatusCode: http.StatusBadRequest,
+				Status:     "400 Bad Request",
+				TrackingID: "ROUTER_2",
+				Message:    "Invalid refresh token",
+			},
+			wantMsg: "Webex API error, StatusCode: 400 Bad Request: Invalid refresh token",
+		},
+		{
+			name:   "tracking ID from header and no body",
+			status: http.StatusBadGateway,
+			header: "ROUTER_3",
+			want: APIError{
+				StatusCode: http.StatusBadGateway,
+				Status:     "502 Bad Gateway",
+				TrackingID: "ROUTER_3",
+			},
+			wantMsg: "Webex API error, StatusCode: 502 Bad Gateway",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: test.status,
+				Status:     fmt.Sprintf("%d %s", test.status, http.StatusText(test.status)),
+				Header:     http.Header{},
+				Body:       io.NopCloser(strings.NewReader(test.body)),
+			}
+			if test.header != "" {
+				resp.Header.Set("Trackingid", test.header)
+			}
+
+			got := newAPIError(resp)
+			if fmt.Sprint(*got) != fmt.Sprint(test.want) {
+				t.Errorf("want: %+v but got: %+v", test.want, *got)
+			}
+			if got.Error() != test.wantMsg {
+				t.Errorf("want: %s but got: %s", test.wantMsg, got.Error())
+			}
+		})
+	}
+}
+
+func TestErrorMessageIncludesTrackingID(t *testing.T) {
+	err := fmt.Errorf("listing: %w", &APIError{Status: "500 Internal Server Error", TrackingID: "ROUTER_4"})
+	if got := errorMessage(err); !strings.HasSuffix(got, "(Tracking ID: ROUTER_4)") {
+		t.Errorf("tracking ID missing from: %s", got)
+	}
+
+	if got := errorMessage(errors.New("boom")); got != "boom" {
+		t.Errorf("want: boom but got: %s", got)
+	}
+}
@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"Webex.API.Integration.And.Visualization/config"
+	"Webex.API.Integration.And.Visualization/persist"
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// DEFAULT_SCOPES are requested for the integrations registered without scopes.
+var DEFAULT_SCOPES = []string{"analytics:read_all", "meeting:schedules_read", "spark:people_read"}
+
+// errUnknownIntegration is returned when the integration picked by the user is not registered.
+var errUnknownIntegration = errors.New("The Webex integration is not available, pick another one.")
+
+// IntegrationOption is an integration as offered to the users, without its secret.
+type IntegrationOption struct {
+	ClientID string
+	Label    string
+	Scopes   []string
+}
+
+// IndexPageData is rendered by the index.html template.
+type IndexPageData struct {
+	Integrations []IntegrationOption
+}
+
+// LoadIntegrationsFile reads the integrations of a JSON file holding an array of integrations:
+//
+//	[{"client_id": "...", "client_secret": "...", "scopes": ["analytics:read_all"], "label": "Analytics"}]
+//
+// The label defaults to the client ID and the scopes to DEFAULT_SCOPES.
+func LoadIntegrationsFile(path string) ([]types.Integration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	integrations, err := parseIntegrations(f)
+	if err != nil {
+		return nil, fmt.Errorf("invalid integrations file %s: %w", path, err)
+	}
+	return integrations, nil
+}
+
+func parseIntegrations(r io.Reader) ([]types.Integration, error) {
+	var integrations []types.Integration
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&integrations); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for i := range integrations {
+		integration := &integrations[i]
+		integration.ClientID = strings.TrimSpace(integration.ClientID)
+		integration.ClientSecret = strings.TrimSpace(integration.ClientSecret)
+		if integration.ClientID == "" || integration.ClientSecret == "" {
+			return nil, fmt.Errorf("integration %d: client_id and client_secret are required", i+1)
+		}
+		if seen[integration.ClientID] {
+			return nil, fmt.Errorf("integration %d: duplicate client_id %s", i+1, integration.ClientID)
+		}
+		seen[integration.ClientID] = true
+
+		if integration.Label == "" {
+			integration.Label = integration.ClientID
+		}
+		if len(integration.Scopes) == 0 {
+			integration.Scopes = DEFAULT_SCOPES
+		}
+	}
+
+	return integrations, nil
+}
+
+// RegisterIntegrations saves the integrations in the persist integrations table, replacing the ones with the same client ID.
+func RegisterIntegrations(db *persist.Persist, integrations []types.Integration) error {
+	for _, integration := range integrations {
+		if err := db.SaveIntegration(integration); err != nil {
+			return fmt.Errorf("integration %s: %w", integration.ClientID, err)
+		}
+	}
+	return nil
+}
+
+// SyncIntegrations registers the configured integrations and unregisters the ones registered from a previous
+// configuration, so the users can no longer pick nor log in with a removed integration.
+// Integrations inserted in the persist integrations table directly are kept when their source is not 'config'.
+func SyncIntegrations(db *persist.Persist, integrations []types.Integration) error {
+	if err := RegisterIntegrations(db, integrations); err != nil {
+		return err
+	}
+
+	keep := make([]string, 0, len(integrations))
+	for _, integration := range integrations {
+		keep = append(keep, integration.ClientID)
+	}
+	removed, err := db.PruneIntegrations(keep)
+	if err != nil {
+		return err
+	}
+	for _, clientID := range removed {
+		log.Printf("unregistered the Webex integration %s, it is no longer configured\n", clientID)
+	}
+	return nil
+}
+
+// RegisterIntegrationsFile registers the integrations of the file, see LoadIntegrationsFile for its format.
+// Integrations can also be inserted in the persist integrations table directly, see SyncIntegrations.
+func RegisterIntegrationsFile(db *persist.Persist, path string) error {
+	integrations, err := LoadIntegrationsFile(path)
+	if err != nil {
+		return err
+	}
+	if err := RegisterIntegrations(db, integrations); err != nil {
+		return err
+	}
+
+	log.Printf("registered %d Webex integrations from %s\n", len(integrations), path)
+	return nil
+}
+
+// IntegrationsFromConfig converts the integrations of the configuration, applying the defaults of LoadIntegrationsFile.
+func IntegrationsFromConfig(cfg *config.Config) []types.Integration {
+	integrations := make([]types.Integration, 0, len(cfg.Integrations))
+	for _, integration := range cfg.Integrations {
+		converted := types.Integration{
+			ClientID:     integration.ClientID,
+			ClientSecret: integration.ClientSecret,
+			Scopes:       integration.Scopes,
+			Label:        integration.Label,
+		}
+		if converted.Label == "" {
+			converted.Label = converted.ClientID
+		}
+		if len(converted.Scopes) == 0 {
+			converted.Scopes = DEFAULT_SCOPES
+		}
+		integrations = append(integrations, converted)
+	}
+	return integrations
+}
+
+// integrationOptions lists the registered integrations the users can pick from.
+func integrationOptions(db *persist.Persist) ([]IntegrationOption, error) {
+	integrations, err := db.ListIntegrations()
+	if err != nil {
+		return nil, err
+	}
+
+	options := make([]IntegrationOption, 0, len(integrations))
+	for _, integration := range integrations {
+		options = append(options, IntegrationOption{
+			ClientID: integration.ClientID,
+			Label:    integration.Label,
+			Scopes:   integration.Scopes,
+		})
+	}
+	return options, nil
+}
+
+// lookupIntegration retrieves the registered integration of the client ID.
+func lookupIntegration(db *persist.Persist, clientID string) (*types.Integration, error) {
+	if clientID == "" {
+		return nil, errUnknownIntegration
+	}
+
+	integration, err := db.RetrieveIntegration(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if integration == nil {
+		return nil, errUnknownIntegration
+	}
+	return integration, nil
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Webex.API.Integration.And.Visualization/persist"
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+func TestParseIntegrations(t *testing.T) {
+	integrations, err := parseIntegrations(strings.NewReader(`[
+		{"client_id": " c1 ", "client_secret": "s1", "label": "Analytics", "scopes": ["analytics:read_all"]},
+		{"client_id": "c2", "client_secret": "s2"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []types.Integration{
+		{ClientID: "c1", ClientSecret: "s1", Label: "Analytics", Scopes: []string{"analytics:read_all"}},
+		{ClientID: "c2", ClientSecret: "s2", Label: "c2", Scopes: DEFAULT_SCOPES},
+	}
+	if !reflect.DeepEqual(integrations, want) {
+		t.Errorf("want %+v, got %+v", want, integrations)
+	}
+
+	for _, invalid := range []string{
+		`{"client_id": "c1"}`,
+		`[{"client_id": "c1"}]`,
+		`[{"client_secret": "s1"}]`,
+		`[{"client_id": "c1", "client_secret": "s1"}, {"client_id": "c1", "client_secret": "s2"}]`,
+		`[{"client_id": "c1", "client_secret": "s1", "secret": "typo"}]`,
+	} {
+		if _, err := parseIntegrations(strings.NewReader(invalid)); err == nil {
+			t.Errorf("want an error for %s", invalid)
+		}
+	}
+}
+
+func TestRegisterIntegrationsFile(t *testing.T) {
+	app := newTestApp(t)
+
+	path := filepath.Join(t.TempDir(), "integrations.json")
+	content := `[{"client_id": "other", "client_secret": "other secret", "label": "Other"}]`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RegisterIntegrationsFile(app.db, path); err != nil {
+		t.Fatal(err)
+	}
+	integration, err := app.db.RetrieveIntegration("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if integration == nil || integration.ClientSecret != "other secret" || !reflect.DeepEqual(integration.Scopes, DEFAULT_SCOPES) {
+		t.Errorf("unexpected registered integration %+v", integration)
+	}
+}
+
+func TestSyncIntegrations(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.db.SaveIntegration(types.Integration{ClientID: "removed", ClientSecret: "removed secret", Label: "Removed"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the integration is no longer configured after a restart
+	configured := []types.Integration{{ClientID: testClientID, ClientSecret: testClientSecret, Scopes: DEFAULT_SCOPES, Label: "Test integration"}}
+	if err := SyncIntegrations(app.db, configured); err != nil {
+		t.Fatal(err)
+	}
+
+	integrations, err := app.db.ListIntegrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(integrations) != 1 || integrations[0].ClientID != testClientID {
+		t.Errorf("want only the configured integration, got %+v", integrations)
+	}
+	if _, body := app.get(t, "/init"); strings.Contains(body, "Removed") {
+		t.Errorf("the removed integration is still offered: %s", body)
+	}
+}
+
+func TestSyncKeepsManualIntegrations(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "webex.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	// a database created before the integrations were synced, its integrations came from the configuration
+	if _, err := db.Exec("CREATE TABLE integrations (client_id TEXT PRIMARY KEY, client_secret TEXT, scopes TEXT, label TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO integrations (client_id, client_secret) VALUES ('legacy', 'legacy secret')"); err != nil {
+		t.Fatal(err)
+	}
+	p, err := persist.NewPersist(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an operator registers an integration by hand, unaware of the source column
+	if _, err := db.Exec("INSERT INTO integrations (client_id, client_secret, label) VALUES ('manual', 'manual secret', 'Manual')"); err != nil {
+		t.Fatal(err)
+	}
+
+	configured := []types.Integration{{ClientID: testClientID, ClientSecret: testClientSecret, Scopes: DEFAULT_SCOPES, Label: "Test integration"}}
+	if err := SyncIntegrations(p, configured); err != nil {
+		t.Fatal(err)
+	}
+
+	integrations, err := p.ListIntegrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, integration := range integrations {
+		got = append(got, integration.ClientID)
+	}
+	if !reflect.DeepEqual(got, []string{"manual", testClientID}) {
+		t.Errorf("want the manual and the configured integrations, got %v", got)
+	}
+}
+
+func TestIntegrationPicker(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.db.SaveIntegration(types.Integration{ClientID: "other", ClientSecret: "other secret", Label: "Other"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := app.get(t, "/init")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s: %s", resp.Status, body)
+	}
+	for _, want := range []string{"Test integration", `value="` + testClientID + `"`, "Other", `value="other"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("want %q in the picker: %s", want, body)
+		}
+	}
+	for _, secret := range []string{testClientSecret, "other secret", "client_secret"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("the picker leaks %q: %s", secret, body)
+		}
+	}
+}
+
+func TestIntegrationPickerWithoutIntegrations(t *testing.T) {
+	app := newTestApp(t)
+	if err := app.db.DeleteIntegration(testClientID); err != nil {
+		t.Fatal(err)
+	}
+
+	_, body := app.get(t, "/init")
+	if !strings.Contains(body, "No Webex integration is configured") || strings.Contains(body, "<form") {
+		t.Errorf("want a notice without a form, got: %s", body)
+	}
+}
+
+func TestInitFlowUnknownIntegration(t *testing.T) {
+	app := newTestApp(t)
+
+	for _, form := range []url.Values{
+		{"integration": {"unknown"}},
+		// the former form is no longer accepted
+		{"client_id": {testClientID}, "client_secret": {testClientSecret}},
+	} {
+		resp, err := app.browser.PostForm(app.server.URL+"/init", form)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := readBody(t, resp)
+
+		if resp.Request.URL.Path != "/error" || !strings.Contains(body, errUnknownIntegration.Error()) {
+			t.Errorf("want the error page, ended at %s with: %s", resp.Request.URL, body)
+		}
+	}
+}
+
+func TestUnregisteredIntegrationCannotCompleteFlow(t *testing.T) {
+	app := newTestApp(t)
+	redirect := app.authorize(t, app.startFlow(t))
+
+	// the integration is removed while the user is at Webex
+	if err := app.db.DeleteIntegration(testClientID); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, body := app.get(t, redirect.RequestURI())
+	if resp.Request.URL.Path != "/error" || !strings.Contains(body, errUnknownIntegration.Error()) {
+		t.Errorf("want the error page, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
@@ -0,0 +1,361 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// MAX_PAGE_SIZE is the largest number of meetings Webex returns in a single page.
+const MAX_PAGE_SIZE = 100
+
+// Meeting types accepted by the List Meetings API.
+const (
+	MEETING_TYPE_SERIES    = "meetingSeries"
+	MEETING_TYPE_SCHEDULED = "scheduledMeeting"
+	MEETING_TYPE_MEETING   = "meeting"
+)
+
+// meetingStates are the meeting states accepted by the List Meetings API.
+var meetingStates = []string{"active", "scheduled", "ready", "lobby", "inProgress", "ended", "missed", "expired"}
+
+// QUERY_PERIOD_DAYS is the number of days of meetings listed when the period is not fully set.
+const QUERY_PERIOD_DAYS = 30
+
+// dateTimeLocal is the layout of the value of a datetime-local HTML input.
+const dateTimeLocal = "2006-01-02T15:04"
+
+// MeetingQuery holds the filters of a List Meetings call, empty fields are not sent to Webex.
+type MeetingQuery struct {
+	// From and To bound the start of the meetings.
+	From time.Time
+	To   time.Time
+	// MeetingType is one of meetingSeries, scheduledMeeting or meeting.
+	MeetingType string
+	// State is one of active, scheduled, ready, lobby, inProgress, ended, missed or expired.
+	State         string
+	HostEmail     string
+	SiteURL       string
+	MeetingNumber string
+	WebLink       string
+	// Max is the page size, Webex's default is used when it is 0.
+	Max int
+}
+
+// DefaultMeetingQuery queries the meetings that took place in the last QUERY_PERIOD_DAYS days.
+func DefaultMeetingQuery() MeetingQuery {
+	now := time.Now()
+	return MeetingQuery{
+		From:        now.AddDate(0, 0, -QUERY_PERIOD_DAYS),
+		To:          now,
+		MeetingType: MEETING_TYPE_MEETING,
+	}
+}
+
+// ParseMeetingQuery overrides the DefaultMeetingQuery with the filters set in the request parameters.
+// The parameters are named after the List Meetings API ones, from and to are RFC 3339 timestamps,
+// datetime-local values or dates. Values without a zone are UTC. When only one of from and to is set, the period
+// spans QUERY_PERIOD_DAYS days from it, e.g. the upcoming meetings are listed with from alone.
+func ParseMeetingQuery(params url.Values) (MeetingQuery, error) {
+	query := DefaultMeetingQuery()
+
+	set := map[string]bool{}
+	for _, bound := range []struct {
+		name string
+		to   *time.Time
+	}{{"from", &query.From}, {"to", &query.To}} {
+		value := strings.TrimSpace(params.Get(bound.name))
+		if value == "" {
+			continue
+		}
+
+		t, err := parseQueryTime(value)
+		if err != nil {
+			return MeetingQuery{}, fmt.Errorf(`invalid "%s" parameter %q`, bound.name, value)
+		}
+		*bound.to = t
+		set[bound.name] = true
+	}
+
+	// the other bound follows the one that is set rather than now
+	switch {
+	case set["from"] && !set["to"]:
+		query.To = query.From.AddDate(0, 0, QUERY_PERIOD_DAYS)
+	case set["to"] && !set["from"]:
+		query.From = query.To.AddDate(0, 0, -QUERY_PERIOD_DAYS)
+	}
+
+	if params.Has("meetingType") {
+		query.MeetingType = strings.TrimSpace(params.Get("meetingType"))
+	}
+	query.State = strings.TrimSpace(params.Get("state"))
+	query.HostEmail = strings.TrimSpace(params.Get("hostEmail"))
+	query.SiteURL = strings.TrimSpace(params.Get("siteUrl"))
+	query.MeetingNumber = strings.Join(strings.Fields(params.Get("meetingNumber")), "")
+	query.WebLink = strings.TrimSpace(params.Get("webLink"))
+
+	if max := params.Get("max"); max != "" {
+		n, err := strconv.Atoi(max)
+		if err != nil {
+			return MeetingQuery{}, fmt.Errorf(`invalid "max" parameter %q`, max)
+		}
+		query.Max = n
+	}
+
+	return query, query.Validate()
+}
+
+func parseQueryTime(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, dateTimeLocal, "2006-01-02"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time %q", value)
+}
+
+// Validate checks the filters against the values accepted by the List Meetings API.
+func (q MeetingQuery) Validate() error {
+	if !q.From.IsZero() && !q.To.IsZero() && q.To.Before(q.From) {
+		return errors.New(`"to" must not be before "from"`)
+	}
+
+	switch q.MeetingType {
+	case "", MEETING_TYPE_SERIES, MEETING_TYPE_SCHEDULED, MEETING_TYPE_MEETING:
+	default:
+		return fmt.Errorf("invalid meeting type %q", q.MeetingType)
+	}
+
+	if q.State != "" {
+		valid := false
+		for _, state := range meetingStates {
+			valid = valid || q.State == state
+		}
+		if !valid {
+			return fmt.Errorf("invalid meeting state %q", q.State)
+		}
+	}
+
+	if q.Max < 0 || q.Max > MAX_PAGE_SIZE {
+		return fmt.Errorf("max must be between 0 and %d, 0 lets Webex pick the page size", MAX_PAGE_SIZE)
+	}
+
+	return nil
+}
+
+// Values encodes the filters as List Meetings query parameters.
+func (q MeetingQuery) Values() url.Values {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+
+	if !q.From.IsZero() {
+		set("from", q.From.Format(time.RFC3339))
+	}
+	if !q.To.IsZero() {
+		set("to", q.To.Format(time.RFC3339))
+	}
+	set("meetingType", q.MeetingType)
+	set("state", q.State)
+	set("hostEmail", q.HostEmail)
+	set("siteUrl", q.SiteURL)
+	set("meetingNumber", q.MeetingNumber)
+	set("webLink", q.WebLink)
+	if q.Max > 0 {
+		set("max", strconv.Itoa(q.Max))
+	}
+
+	return values
+}
+
+// FormValues encodes the filters for the filter form of the meetings page, times are in the datetime-local layout.
+// They are formatted in UTC, the zone ParseMeetingQuery reads them in, so submitting the form keeps the filters.
+func (q MeetingQuery) FormValues() url.Values {
+	values := q.Values()
+	if !q.From.IsZero() {
+		values.Set("from", q.From.UTC().Format(dateTimeLocal))
+	}
+	if !q.To.IsZero() {
+		values.Set("to", q.To.UTC().Format(dateTimeLocal))
+	}
+	return values
+}
+
+// ListMeetings lists all meetings matching the query that are accessible to the client account.
+// Every page is fetched, query.Max sets the page size.
+func (c *WebexAPIClient) ListMeetings(query MeetingQuery) (*types.MeetingsList, error) {
+	return c.ListMeetingsContext(context.Background(), query)
+}
+
+// ListMeetingsContext is like ListMeetings, the pending requests are cancelled when ctx is done.
+func (c *WebexAPIClient) ListMeetingsContext(ctx context.Context, query MeetingQuery) (*types.MeetingsList, error) {
+	meetings := &types.MeetingsList{Items: []types.MeetingSeries{}}
+
+	it := c.MeetingsContext(ctx, query)
+	for it.Next() {
+		meetings.Items = append(meetings.Items, it.Meeting())
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+
+	return meetings, nil
+}
+
+// Meetings returns an iterator over all meetings matching the query that are accessible to the client account.
+// Pages of query.Max meetings are fetched as the iterator advances.
+func (c *WebexAPIClient) Meetings(query MeetingQuery) *MeetingIterator {
+	return c.MeetingsContext(context.Background(), query)
+}
+
+// MeetingsContext is like Meetings, the iterator stops with ctx's error once ctx is done.
+func (c *WebexAPIClient) MeetingsContext(ctx context.Context, query MeetingQuery) *MeetingIterator {
+	it := &MeetingIterator{ctx: ctx, client: c}
+	if it.err = query.Validate(); it.err == nil {
+		it.next = c.Options.MeetingsURL() + "?" + query.Values().Encode()
+	}
+
+	return it
+}
+
+// MeetingIterator walks the pages of a List Meetings call by following the "next" links returned by Webex.
+//
+//	it := client.Meetings(MeetingQuery{MeetingType: MEETING_TYPE_MEETING, Max: 100})
+//	for it.Next() {
+//		meeting := it.Meeting()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type MeetingIterator struct {
+	ctx     context.Context
+	client  *WebexAPIClient
+	next    string
+	page    []types.MeetingSeries
+	current types.MeetingSeries
+	err     error
+}
+
+// Next advances the iterator to the next meeting, fetching the next page when the current one is consumed.
+// It returns false when there are no more meetings or an error occurred.
+func (it *MeetingIterator) Next() bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.next == "" {
+			return false
+		}
+
+		meetings, next, err := it.client.fetchMeetingsPage(it.ctx, it.next, 0)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page, it.next = meetings.Items, next
+	}
+
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Meeting returns the meeting the iterator is at.
+func (it *MeetingIterator) Meeting() types.MeetingSeries {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *MeetingIterator) Err() error {
+	return it.err
+}
+
+// fetchMeetingsPage fetches a single page of meetings and the link to the next page, empty on the last page.
+func (c *WebexAPIClient) fetchMeetingsPage(ctx context.Context, pageURL string, tries int) (*types.MeetingsList, string, error) {
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, "", err
+	}
+
+	resp, err := c.Options.do(ctx, func() (*http.Request, error) {
+		req, err := c.Options.newRequest(ctx, http.MethodGet, pageURL, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Authorization", "Bearer "+c.Auth.AccessToken)
+		return req, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var meetings types.MeetingsList
+		if err := json.NewDecoder(resp.Body).Decode(&meetings); err != nil {
+			return nil, "", err
+		}
+
+		next, err := nextLink(resp)
+		if err != nil {
+			return nil, "", err
+		}
+		return &meetings, next, nil
+
+	case http.StatusUnauthorized:
+		if tries >= 3 {
+			return nil, "", newAPIError(resp)
+		}
+		if err = c.refreshToken(ctx); err != nil {
+			return nil, "", err
+		}
+		return c.fetchMeetingsPage(ctx, pageURL, tries+1)
+
+	case http.StatusNoContent:
+		return &types.MeetingsList{}, "", nil
+
+	default:
+		return nil, "", newAPIError(resp)
+	}
+}
+
+// nextLink returns the absolute URL of the RFC 5988 Link header entry with rel="next", empty when there is none.
+// Sample header: <https://webexapis.com/v1/meetings?max=10&offset=10>; rel="next"
+func nextLink(resp *http.Response) (string, error) {
+	for _, header := range resp.Header.Values("Link") {
+		for _, link := range strings.Split(header, ",") {
+			params := strings.Split(link, ";")
+			target := strings.TrimSpace(params[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+
+			for _, param := range params[1:] {
+				key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+
+				for _, rel := range strings.Fields(strings.Trim(strings.TrimSpace(value), `"`)) {
+					if strings.EqualFold(rel, "next") {
+						next, err := resp.Request.URL.Parse(strings.Trim(target, "<>"))
+						if err != nil {
+							return "", fmt.Errorf("invalid next link %q: %w", target, err)
+						}
+						return next.String(), nil
+					}
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestNextLink(t *testing.T) {
+	reqURL, _ := url.Parse("https://webexapis.com/v1/meetings?max=10")
+	tests := []struct {
+		name   string
+		header []string
+		want   string
+	}{
+		{
+			name:   "no link",
+			header: nil,
+			want:   "",
+		},
+		{
+			name:   "next link",
+			header: []string{`<https://webexapis.com/v1/meetings?max=10&offset=10>; rel="next"`},
+			want:   "https://webexapis.com/v1/meetings?max=10&offset=10",
+		},
+		{
+			name:   "next among other links",
+			header: []string{`<https://webexapis.com/v1/meetings?max=10>; rel="first", <https://webexapis.com/v1/meetings?max=10&offset=20>; rel="next"`},
+			want:   "https://webexapis.com/v1/meetings?max=10&offset=20",
+		},
+		{
+			name:   "next in a repeated header",
+			header: []string{`<https://webexapis.com/v1/meetings?max=10>; rel="prev"`, `<https://webexapis.com/v1/meetings?max=10&offset=30>; rel=next`},
+			want:   "https://webexapis.com/v1/meetings?max=10&offset=30",
+		},
+		{
+			name:   "relative link",
+			header: []string{`</v1/meetings?max=10&offset=10>; rel="next"`},
+			want:   "https://webexapis.com/v1/meetings?max=10&offset=10",
+		},
+		{
+			name:   "only last link",
+			header: []string{`<https://webexapis.com/v1/meetings?max=10&offset=90>; rel="last"`},
+			want:   "",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}, Request: &http.Request{URL: reqURL}}
+			for _, h := range test.header {
+				resp.Header.Add("Link", h)
+			}
+
+			got, err := nextLink(resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("want: %s but got: %s", test.want, got)
+			}
+		})
+	}
+}
+
+func TestParseMeetingQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  url.Values
+		check   func(MeetingQuery) bool
+		wantErr bool
+	}{
+		{
+			name:   "defaults",
+			params: url.Values{},
+			check: func(q MeetingQuery) bool {
+				return q.MeetingType == MEETING_TYPE_MEETING && q.To.Sub(q.From) > 29*24*time.Hour
+			},
+		},
+		{
+			name:   "RFC 3339 and datetime-local bounds",
+			params: url.Values{"from": {"2022-04-01T10:00:00Z"}, "to": {"2022-04-02T10:30"}},
+			check: func(q MeetingQuery) bool {
+				return q.From.Equal(time.Date(2022, 4, 1, 10, 0, 0, 0, time.UTC)) &&
+					q.To.Equal(time.Date(2022, 4, 2, 10, 30, 0, 0, time.UTC))
+			},
+		},
+		{
+			name:   "upcoming meetings from a future date",
+			params: url.Values{"from": {time.Now().AddDate(0, 0, 7).UTC().Format("2006-01-02")}, "meetingType": {MEETING_TYPE_SCHEDULED}},
+			check: func(q MeetingQuery) bool {
+				return q.From.After(time.Now()) && q.To.Equal(q.From.AddDate(0, 0, QUERY_PERIOD_DAYS))
+			},
+		},
+		{
+			name:   "period before a past date",
+			params: url.Values{"to": {"2022-04-02"}},
+			check: func(q MeetingQuery) bool {
+				return q.To.Equal(time.Date(2022, 4, 2, 0, 0, 0, 0, time.UTC)) && q.From.Equal(q.To.AddDate(0, 0, -QUERY_PERIOD_DAYS))
+			},
+		},
+		{
+			name:   "empty meeting type lists every type",
+			params: url.Values{"meetingType": {""}, "state": {"ended"}, "hostEmail": {" host@example.com "}},
+			check: func(q MeetingQuery) bool {
+				return q.MeetingType == "" && q.State == "ended" && q.HostEmail == "host@example.com"
+			},
+		},
+		{
+			name:   "meeting number spaces are dropped",
+			params: url.Values{"meetingNumber": {"123 456 789"}},
+			check:  func(q MeetingQuery) bool { return q.MeetingNumber == "123456789" },
+		},
+		{
+			name:    "invalid meeting type",
+			params:  url.Values{"meetingType": {"webinar"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid state",
+			params:  url.Values{"state": {"over"}},
+			wantErr: true,
+		},
+		{
+			name:    "to before from",
+			params:  url.Values{"from": {"2022-04-02"}, "to": {"2022-04-01"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid from",
+			params:  url.Values{"from": {"yesterday"}},
+			wantErr: true,
+		},
+		{
+			name:    "max above the Webex limit",
+			params:  url.Values{"max": {"101"}},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseMeetingQuery(test.params)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("wantErr: %v but got err: %v", test.wantErr, err)
+			}
+			if err == nil && !test.check(got) {
+				t.Errorf("unexpected query: %+v", got)
+			}
+		})
+	}
+}
+
+func TestFormValuesKeepTheFilters(t *testing.T) {
+	// the server runs in another zone than UTC
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	query := DefaultMeetingQuery()
+	query.From = time.Date(2022, 4, 1, 10, 0, 0, 0, time.Local)
+	query.To = time.Date(2022, 4, 2, 22, 30, 0, 0, time.Local)
+
+	// submitting the form as rendered gives the same filters back
+	got, err := ParseMeetingQuery(query.FormValues())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.From.Equal(query.From) || !got.To.Equal(query.To) {
+		t.Errorf("want from %s to %s, got from %s to %s", query.From, query.To, got.From, got.To)
+	}
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// ErrOAuthStateMismatch is returned when the state Webex redirects back with is not the one of the browser's flow,
+// the redirect may have been forged to log the user into another account.
+var ErrOAuthStateMismatch = errors.New("The authentication request could not be verified, start the authentication flow again.")
+
+// ErrOAuthRequestExpired is returned when Webex redirects back after the flow has expired, or in a browser that never started it.
+var ErrOAuthRequestExpired = errors.New("The authentication request has expired, start the authentication flow again.")
+
+// newOAuthRequest starts a flow with a random state and PKCE code verifier.
+// The request is kept in the browser's sealed OAuthRequest cookie, binding the state to the browser that started the flow.
+func newOAuthRequest(clientID, scope string) (types.OAuthRequest, error) {
+	state, err := randomString(16)
+	if err != nil {
+		return types.OAuthRequest{}, err
+	}
+	verifier, err := randomString(32)
+	if err != nil {
+		return types.OAuthRequest{}, err
+	}
+
+	return types.OAuthRequest{
+		ClientID:     clientID,
+		Scope:        scope,
+		State:        state,
+		CodeVerifier: verifier,
+	}, nil
+}
+
+// verifyState checks the state Webex redirected back with against the one the flow was started with.
+func verifyState(oauthReq types.OAuthRequest, state string) error {
+	if oauthReq.State == "" || subtle.ConstantTimeCompare([]byte(oauthReq.State), []byte(state)) != 1 {
+		return ErrOAuthStateMismatch
+	}
+	return nil
+}
+
+// codeChallenge is the S256 PKCE code challenge of the verifier (RFC 7636).
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// randomString is n random bytes, base64url encoded.
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
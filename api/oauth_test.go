@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startFlow posts the "/init" form and returns the Webex authorize URL the browser is redirected to.
+func (a *testApp) startFlow(t *testing.T) *url.URL {
+	t.Helper()
+
+	noRedirect := *a.browser
+	noRedirect.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := noRedirect.PostForm(a.server.URL+"/init", url.Values{
+		"integration": {testClientID},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, resp)
+
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+// authorize has the fake Webex grant the flow and returns the "/auth" URL it redirects back to.
+func (a *testApp) authorize(t *testing.T, authorizeURL *url.URL) *url.URL {
+	t.Helper()
+
+	noRedirect := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noRedirect.Get(authorizeURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, resp)
+
+	location, err := resp.Location()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location
+}
+
+func TestInitFlowSendsStateAndPKCE(t *testing.T) {
+	app := newTestApp(t)
+
+	first := app.startFlow(t).Query()
+	second := app.startFlow(t).Query()
+
+	if first.Get("state") == "" || first.Get("state") == second.Get("state") {
+		t.Errorf("want a random state per flow, got %q and %q", first.Get("state"), second.Get("state"))
+	}
+	if first.Get("code_challenge") == "" || first.Get("code_challenge_method") != "S256" {
+		t.Errorf("want a S256 code challenge, got %q with %q", first.Get("code_challenge"), first.Get("code_challenge_method"))
+	}
+	if first.Get("code_challenge") == second.Get("code_challenge") {
+		t.Error("want a code verifier per flow")
+	}
+}
+
+func TestAuthRejectsInvalidFlows(t *testing.T) {
+	tests := []struct {
+		name string
+		// redirect tampers with the redirect of Webex to "/auth" before the browser follows it
+		redirect func(t *testing.T, app *testApp, u *url.URL)
+		want     string
+	}{
+		{
+			name: "state mismatch",
+			redirect: func(t *testing.T, app *testApp, u *url.URL) {
+				q := u.Query()
+				q.Set("state", "some state")
+				u.RawQuery = q.Encode()
+			},
+			want: ErrOAuthStateMismatch.Error(),
+		},
+		{
+			name: "missing state",
+			redirect: func(t *testing.T, app *testApp, u *url.URL) {
+				q := u.Query()
+				q.Del("state")
+				u.RawQuery = q.Encode()
+			},
+			want: ErrOAuthStateMismatch.Error(),
+		},
+		{
+			name: "expired flow",
+			redirect: func(t *testing.T, app *testApp, u *url.URL) {
+				app.sessions.codec.clock = func() time.Time { return time.Now().Add(OAUTH_REQUEST_TTL + time.Minute) }
+			},
+			want: ErrOAuthRequestExpired.Error(),
+		},
+		{
+			name: "flow started in another browser",
+			redirect: func(t *testing.T, app *testApp, u *url.URL) {
+				jar, err := cookiejar.New(nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				app.browser.Jar = jar
+			},
+			want: ErrOAuthRequestExpired.Error(),
+		},
+		{
+			name: "access denied",
+			redirect: func(t *testing.T, app *testApp, u *url.URL) {
+				u.RawQuery = url.Values{"error": {"access_denied"}, "state": {u.Query().Get("state")}}.Encode()
+			},
+			want: "Webex authorization failed: access_denied",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := newTestApp(t)
+			redirect := app.authorize(t, app.startFlow(t))
+			test.redirect(t, app, redirect)
+
+			resp, err := app.browser.Get(redirect.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := readBody(t, resp)
+
+			if resp.Request.URL.Path != "/error" || !strings.Contains(body, test.want) {
+				t.Errorf("want the error page with %q, ended at %s with: %s", test.want, resp.Request.URL, body)
+			}
+		})
+	}
+}
+
+func TestAuthCannotBeReplayed(t *testing.T) {
+	app := newTestApp(t)
+	redirect := app.authorize(t, app.startFlow(t))
+
+	resp, body := app.get(t, redirect.RequestURI())
+	if resp.Request.URL.Path != "/message" {
+		t.Fatalf("OAuth flow ended at %s with: %s", resp.Request.URL, body)
+	}
+
+	// the OAuth request cookie was cleared once used
+	resp, body = app.get(t, redirect.RequestURI())
+	if resp.Request.URL.Path != "/error" || !strings.Contains(body, ErrOAuthRequestExpired.Error()) {
+		t.Errorf("want the replayed redirect rejected, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func TestPKCECodeVerifier(t *testing.T) {
+	app := newTestApp(t)
+
+	oauthReq, err := newOAuthRequest(testClientID, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizeURL, _ := url.Parse(app.opts.AuthURL())
+	authorizeURL.RawQuery = url.Values{
+		"client_id":             {testClientID},
+		"redirect_uri":          {app.server.URL + "/auth"},
+		"state":                 {oauthReq.State},
+		"code_challenge":        {codeChallenge(oauthReq.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+	code := app.authorize(t, authorizeURL).Query().Get("code")
+
+	// the code cannot be exchanged without the verifier
+	if _, err := NewWebexAPIClientPKCE(context.Background(), app.opts, code, "wrong verifier", testClientID, testClientSecret, app.server.URL+"/auth"); err == nil {
+		t.Error("want the code rejected with a wrong verifier")
+	}
+
+	code = app.authorize(t, authorizeURL).Query().Get("code")
+	if _, err := NewWebexAPIClientPKCE(context.Background(), app.opts, code, oauthReq.CodeVerifier, testClientID, testClientSecret, app.server.URL+"/auth"); err != nil {
+		t.Errorf("want the code exchanged with the verifier, got %v", err)
+	}
+}
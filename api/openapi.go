@@ -0,0 +1,27 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// OPENAPI_PATH is where the OpenAPI document of the JSON API is served.
+const OPENAPI_PATH = "/api/openapi.json"
+
+// openAPIDocument is the OpenAPI 3 document describing the JSON API and its types payloads.
+// It is written by hand, the contract test checks the handlers answer what it describes.
+//
+//go:embed openapi.json
+var openAPIDocument []byte
+
+// openAPI serves the OpenAPI document, it does not require a session so clients can be generated from it.
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSONError(w, http.StatusMethodNotAllowed, "Only GET is allowed.")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIDocument)
+}
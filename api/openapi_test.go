@@ -0,0 +1,233 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+
+	"Webex.API.Integration.And.Visualization/types"
+	"Webex.API.Integration.And.Visualization/webexapi"
+	"Webex.API.Integration.And.Visualization/webextest"
+)
+
+func TestOpenAPIDocumentIsValid(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPIDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestOpenAPIContract checks the responses of the handlers against the OpenAPI document,
+// every operation and every status it documents for the JSON API must be exercised.
+func TestOpenAPIContract(t *testing.T) {
+	// Webex answering later than the timeout makes the server answer 504
+	timeout := 200 * time.Millisecond
+	app := newTestApp(t, func(opts *ClientOptions) { opts.Timeout = timeout })
+	meetings := app.webex.AddMeetings(4)
+	slow := webextest.Response{Status: http.StatusOK, Delay: 2 * timeout}
+
+	doc, err := openapi3.NewLoader().LoadFromData(openAPIDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Servers = openapi3.Servers{{URL: app.server.URL}}
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// check requests path, which must be answered status
+	exercised := map[string]bool{}
+	check := func(path string, status int) {
+		t.Helper()
+
+		resp, err := app.browser.Get(app.server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status {
+			t.Errorf("GET %s: want %d, got %d: %s", path, status, resp.StatusCode, body)
+			return
+		}
+
+		route, pathParams, err := router.FindRoute(resp.Request)
+		if err != nil {
+			t.Errorf("GET %s is not documented: %v", path, err)
+			return
+		}
+		exercised[route.Operation.OperationID+" "+resp.Status[:3]] = true
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    resp.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    &openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		}
+		// the requests answered with an error may be invalid on purpose
+		if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil && status < 400 {
+			t.Errorf("GET %s does not match the document: %v", path, err)
+		}
+		err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: input,
+			Status:                 resp.StatusCode,
+			Header:                 resp.Header,
+			Body:                   io.NopCloser(strings.NewReader(string(body))),
+		})
+		if err != nil {
+			t.Errorf("GET %s answered %d not matching the document: %v", path, status, err)
+		}
+	}
+
+	id := meetings[0].ID
+	check(OPENAPI_PATH, http.StatusOK)
+
+	// without a session
+	check("/api/v1/meetings", http.StatusUnauthorized)
+	check("/api/v1/meetings/"+id+"/qualities", http.StatusUnauthorized)
+	check("/api/v1/meetings/"+id+"/visual", http.StatusUnauthorized)
+
+	app.login(t)
+	check("/api/v1/meetings", http.StatusOK)
+	check("/api/v1/meetings?from=2024-01-01&to=2024-02-01T10:00:00Z&state=ended", http.StatusOK)
+	check("/api/v1/meetings?from=yesterday", http.StatusBadRequest)
+	app.webex.ScriptMeetings(
+		webextest.Response{Status: http.StatusForbidden},
+		webextest.Response{Status: http.StatusTooManyRequests, RetryAfter: 5 * time.Minute},
+		webextest.Response{Status: http.StatusBadRequest},
+		slow,
+	)
+	check("/api/v1/meetings", http.StatusForbidden)
+	check("/api/v1/meetings", http.StatusTooManyRequests)
+	check("/api/v1/meetings", http.StatusBadGateway)
+	check("/api/v1/meetings", http.StatusGatewayTimeout)
+	check("/api/v1/meetings/"+id+"/qualities", http.StatusOK)
+
+	// the qualities of the last meeting were never fetched, so none are persisted to fall back on
+	unfetched := meetings[2].ID
+	app.webex.ScriptQualities(unfetched,
+		webextest.Response{Status: http.StatusNoContent},
+		webextest.Response{Status: http.StatusTooManyRequests, RetryAfter: 5 * time.Minute},
+		webextest.Response{Status: http.StatusBadRequest},
+		webextest.Response{Status: http.StatusForbidden},
+		slow,
+		webextest.Response{Status: http.StatusNoContent},
+		webextest.Response{Status: http.StatusTooManyRequests, RetryAfter: 5 * time.Minute},
+		webextest.Response{Status: http.StatusBadRequest},
+		webextest.Response{Status: http.StatusForbidden},
+		slow,
+	)
+	for _, status := range []int{http.StatusNotFound, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusForbidden, http.StatusGatewayTimeout} {
+		check("/api/v1/meetings/"+unfetched+"/qualities", status)
+	}
+	for _, status := range []int{http.StatusNotFound, http.StatusTooManyRequests, http.StatusBadGateway, http.StatusForbidden, http.StatusGatewayTimeout} {
+		check("/api/v1/meetings/"+unfetched+"/visual", status)
+	}
+	for _, dp := range types.DATA_POINTS {
+		check("/api/v1/meetings/"+id+"/visual?dp="+dp, http.StatusOK)
+	}
+	check("/api/v1/meetings/"+meetings[1].ID+"/visual", http.StatusOK)
+	check("/api/v1/meetings/"+id+"/visual?dp=smell_in", http.StatusBadRequest)
+
+	// the intervals whose times cannot be read are left out rather than failing the chart
+	broken := meetings[3].ID
+	app.webex.SetQualities(broken, &types.MeetingQualities{MediaSessions: []types.MediaSessionQuality{{
+		MeetingID: broken,
+		AudioIn:   []types.MediaQualityData{{StartTime: "yesterday", EndTime: "today", SamplingInterval: 60, PacketLoss: []float32{1}}},
+	}}})
+	check("/api/v1/meetings/"+broken+"/visual", http.StatusOK)
+
+	// every operation of the document is exercised with every status it documents
+	for path, item := range doc.Paths {
+		for method, operation := range item.Operations() {
+			for status := range operation.Responses {
+				if !exercised[operation.OperationID+" "+status] {
+					t.Errorf("%s %s is documented to answer %s but it is not exercised", method, path, status)
+				}
+			}
+		}
+	}
+}
+
+// TestGeneratedClient calls every operation of the client generated from the OpenAPI document.
+func TestGeneratedClient(t *testing.T) {
+	app := newTestApp(t)
+	meetings := app.webex.AddMeetings(2)
+	app.login(t)
+	ctx := context.Background()
+
+	// the browser's jar holds the session cookie
+	client := webexapi.NewClient(app.server.URL)
+	client.HTTPClient = app.browser
+
+	list, err := client.ListMeetings(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != len(meetings) {
+		t.Errorf("want %d meetings, got %d", len(meetings), len(list.Items))
+	}
+	number := meetings[1].MeetingNumber
+	if list, err = client.ListMeetings(ctx, &webexapi.ListMeetingsParams{MeetingNumber: &number}); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Items) != 1 || list.Items[0].ID != meetings[1].ID {
+		t.Errorf("want only meeting %s, got %+v", meetings[1].ID, list.Items)
+	}
+
+	id := meetings[0].ID
+	qualities, err := client.GetMeetingQualities(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := app.webex.Qualities(id); qualities.MeetingID != id || len(qualities.Items) != len(want.MediaSessions) {
+		t.Errorf("want the %d media sessions of %s, got %d of %s", len(want.MediaSessions), id, len(qualities.Items), qualities.MeetingID)
+	}
+
+	dp := "video_in"
+	visual, err := client.GetVisualData(ctx, id, &webexapi.GetVisualDataParams{Dp: &dp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if visual.MeetingID != id || visual.DataPoint != dp {
+		t.Errorf("want %s of %s, got %s of %s", dp, id, visual.DataPoint, visual.MeetingID)
+	}
+
+	doc, err := client.GetOpenAPI(ctx)
+	if err != nil || doc["openapi"] == nil {
+		t.Errorf("want the OpenAPI document, got %v, %v", doc, err)
+	}
+
+	// a personal access token authenticates without the session
+	tokenClient := webexapi.NewClient(app.server.URL)
+	tokenClient.Token = app.createToken(t, "generated client")
+	if _, err := tokenClient.ListMeetings(ctx, nil); err != nil {
+		t.Errorf("want the meetings with the access token, got %v", err)
+	}
+
+	// the other responses are errors carrying the ErrorResponse body
+	var apiErr *webexapi.Error
+	dp = "smell_in"
+	if _, err := client.GetVisualData(ctx, id, &webexapi.GetVisualDataParams{Dp: &dp}); !errors.As(err, &apiErr) ||
+		apiErr.StatusCode != http.StatusBadRequest || apiErr.Status != http.StatusBadRequest || apiErr.Message == "" {
+		t.Errorf("want a 400 error, got %v", err)
+	}
+	if _, err := webexapi.NewClient(app.server.URL).ListMeetings(ctx, nil); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("want a 401 error without authentication, got %v", err)
+	}
+}
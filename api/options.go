@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"Webex.API.Integration.And.Visualization/config"
+)
+
+const (
+	// DEFAULT_BASE_URL is the Webex REST API used for the OAuth flow and for listing meetings.
+	DEFAULT_BASE_URL = "https://webexapis.com/v1"
+	// DEFAULT_ANALYTICS_BASE_URL is the Webex analytics API used for meeting qualities.
+	DEFAULT_ANALYTICS_BASE_URL = "https://analytics.webexapis.com/v1"
+	// DEFAULT_USER_AGENT is sent with every request made to the Webex API.
+	DEFAULT_USER_AGENT = "Webex.API.Integration.And.Visualization"
+	// DEFAULT_TIMEOUT bounds a single request made to the Webex API.
+	DEFAULT_TIMEOUT = 30 * time.Second
+)
+
+// ClientOptions control where and how the WebexAPIClient talks to Webex.
+// They allow the client to be pointed at a local stand-in, a proxy or a regional Webex deployment.
+// The zero value is valid and uses the public Webex endpoints.
+type ClientOptions struct {
+	// BaseURL is the root of the Webex REST API, e.g. https://webexapis.com/v1.
+	BaseURL string
+	// AnalyticsBaseURL is the root of the Webex analytics API, e.g. https://analytics.webexapis.com/v1.
+	AnalyticsBaseURL string
+	// HTTPClient is used for every call, when nil a client with Timeout is created.
+	HTTPClient *http.Client
+	// UserAgent is set on every request.
+	UserAgent string
+	// Timeout is applied when no HTTPClient is provided.
+	Timeout time.Duration
+	// Retry is the policy for requests Webex could not serve for now, DefaultRetryPolicy when zero.
+	Retry RetryPolicy
+	// RefreshLeeway is how long before its expiry the access token is refreshed, DEFAULT_REFRESH_LEEWAY when zero.
+	RefreshLeeway time.Duration
+	// QualitiesCacheTTL is how long persisted meeting qualities are served without asking Webex again, 0 disables it.
+	QualitiesCacheTTL time.Duration
+}
+
+// ClientOptionsFromConfig creates the client options of the Webex settings of the configuration.
+func ClientOptionsFromConfig(cfg *config.Config) ClientOptions {
+	return ClientOptions{
+		BaseURL:           cfg.Webex.BaseURL,
+		AnalyticsBaseURL:  cfg.Webex.AnalyticsBaseURL,
+		UserAgent:         cfg.Webex.UserAgent,
+		Timeout:           cfg.Webex.Timeout.Duration,
+		QualitiesCacheTTL: cfg.Cache.QualitiesTTL.Duration,
+	}
+}
+
+// AuthURL is the page the user is redirected to in order to authorize the integration.
+func (o ClientOptions) AuthURL() string {
+	return o.baseURL() + "/authorize"
+}
+
+// TokenURL is used to exchange an OAuth code or a refresh token for an access token.
+func (o ClientOptions) TokenURL() string {
+	return o.baseURL() + "/access_token"
+}
+
+// PeopleMeURL is the Get My Own Details endpoint.
+func (o ClientOptions) PeopleMeURL() string {
+	return o.baseURL() + "/people/me"
+}
+
+// MeetingsURL is the List Meetings endpoint.
+func (o ClientOptions) MeetingsURL() string {
+	return o.baseURL() + "/meetings"
+}
+
+// MeetingQualitiesURL is the Get Meeting Qualities endpoint.
+func (o ClientOptions) MeetingQualitiesURL() string {
+	base := strings.TrimSuffix(o.AnalyticsBaseURL, "/")
+	if base == "" {
+		base = DEFAULT_ANALYTICS_BASE_URL
+	}
+	return base + "/meeting/qualities"
+}
+
+func (o ClientOptions) baseURL() string {
+	base := strings.TrimSuffix(o.BaseURL, "/")
+	if base == "" {
+		return DEFAULT_BASE_URL
+	}
+	return base
+}
+
+func (o ClientOptions) httpClient() *http.Client {
+	if o.HTTPClient != nil {
+		return o.HTTPClient
+	}
+
+	timeout := o.Timeout
+	if timeout == 0 {
+		timeout = DEFAULT_TIMEOUT
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// newRequest creates a request to the Webex API carrying the configured user agent, bound to ctx.
+func (o ClientOptions) newRequest(ctx context.Context, method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	userAgent := o.UserAgent
+	if userAgent == "" {
+		userAgent = DEFAULT_USER_AGENT
+	}
+	req.Header.Set("User-Agent", userAgent)
+	return req, nil
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// GetMe gets the Webex user the client was authorized by.
+func (c *WebexAPIClient) GetMe(ctx context.Context) (*types.Person, error) {
+	return c.getMe(ctx, 0)
+}
+
+func (c *WebexAPIClient) getMe(ctx context.Context, tries int) (*types.Person, error) {
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Options.do(ctx, func() (*http.Request, error) {
+		req, err := c.Options.newRequest(ctx, http.MethodGet, c.Options.PeopleMeURL(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Add("Authorization", "Bearer "+c.Auth.AccessToken)
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var person types.Person
+		if err := json.NewDecoder(resp.Body).Decode(&person); err != nil {
+			return nil, err
+		}
+		if person.ID == "" {
+			return nil, errors.New("Webex did not tell who authorized the integration.")
+		}
+		return &person, nil
+
+	case http.StatusForbidden:
+		return nil, fmt.Errorf("Webex did not grant the %s scope needed to identify the user, grant it to log in.", strings.Join(BASE_SCOPES, " "))
+
+	case http.StatusUnauthorized:
+		if tries >= 3 {
+			return nil, newAPIError(resp)
+		}
+		if err = c.refreshToken(ctx); err != nil {
+			return nil, err
+		}
+		return c.getMe(ctx, tries+1)
+
+	default:
+		return nil, newAPIError(resp)
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"Webex.API.Integration.And.Visualization/persist"
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// API_V1_PREFIX is the path of the version 1 of the JSON API.
+const API_V1_PREFIX = "/api/v1"
+
+// apiV1 serves the JSON API, the routes are:
+//
+//	GET /api/v1/meetings                       types.MeetingsList, filtered like /get_meetings_page
+//	GET /api/v1/meetings/{id}/qualities        types.MeetingQualities
+//	GET /api/v1/meetings/{id}/visual?dp=<dp>   types.VisualData, dp defaults to audio_in
+//
+// The user is authenticated by the session cookie, machine clients by a personal access token sent as
+// "Authorization: Bearer <token>". Errors are answered with a types.ErrorResponse body.
+func apiV1(db *persist.Persist, host string, opts ClientOptions, sessions *sessionStore, tokens *tokenStore, features []Feature) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSONError(w, http.StatusMethodNotAllowed, "Only GET is allowed.")
+			return
+		}
+
+		// route on the path segments after the prefix
+		segments := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, API_V1_PREFIX), "/"), "/")
+		switch {
+		case len(segments) == 1 && segments[0] == "meetings":
+			apiMeetings(w, r, host, opts, sessions, tokens, features)
+		case len(segments) == 3 && segments[0] == "meetings" && segments[1] != "" && segments[2] == "qualities":
+			apiQualities(w, r, db, host, opts, sessions, tokens, features, segments[1])
+		case len(segments) == 3 && segments[0] == "meetings" && segments[1] != "" && segments[2] == "visual":
+			apiVisual(w, r, db, host, opts, sessions, tokens, features, segments[1])
+		default:
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("No API endpoint at %s.", r.URL.Path))
+		}
+	}
+}
+
+// apiMeetings lists every page of the meetings matching the query parameters.
+func apiMeetings(w http.ResponseWriter, r *http.Request, host string, opts ClientOptions, sessions *sessionStore, tokens *tokenStore, features []Feature) {
+	client, ok := apiClient(w, r, host, opts, sessions, tokens, features, FEATURE_MEETINGS)
+	if !ok {
+		return
+	}
+
+	query, err := ParseMeetingQuery(r.URL.Query())
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Max == 0 {
+		query.Max = MAX_PAGE_SIZE
+	}
+
+	meetings := types.MeetingsList{Items: []types.MeetingSeries{}}
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	it := client.MeetingsContext(ctx, query)
+	for it.Next() {
+		meetings.Items = append(meetings.Items, it.Meeting())
+	}
+	if err := it.Err(); err != nil {
+		writeClientError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, meetings)
+}
+
+// apiQualities answers the meeting qualities of the meeting.
+func apiQualities(w http.ResponseWriter, r *http.Request, db *persist.Persist, host string, opts ClientOptions, sessions *sessionStore, tokens *tokenStore, features []Feature, id string) {
+	qualities, ok := apiFetchQualities(w, r, db, host, opts, sessions, tokens, features, id)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, qualities)
+}
+
+// apiVisual answers the chart data of the data point given by the dp parameter.
+func apiVisual(w http.ResponseWriter, r *http.Request, db *persist.Persist, host string, opts ClientOptions, sessions *sessionStore, tokens *tokenStore, features []Feature, id string) {
+	dp := r.URL.Query().Get("dp")
+	if dp == "" {
+		dp = "audio_in"
+	}
+	if !types.ValidDataPoint(dp) {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("Unknown data point %q.", dp))
+		return
+	}
+
+	qualities, ok := apiFetchQualities(w, r, db, host, opts, sessions, tokens, features, id)
+	if !ok {
+		return
+	}
+
+	// the intervals that cannot be charted are left out, the data point was checked above
+	visualData, err := types.GetVisualData(qualities, dp)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, visualData)
+}
+
+// apiFetchQualities fetches the meeting qualities of the meeting, the error is answered when it fails.
+func apiFetchQualities(w http.ResponseWriter, r *http.Request, db *persist.Persist, host string, opts ClientOptions, sessions *sessionStore, tokens *tokenStore, features []Feature, id string) (*types.MeetingQualities, bool) {
+	client, ok := apiClient(w, r, host, opts, sessions, tokens, features, FEATURE_ANALYTICS)
+	if !ok {
+		return nil, false
+	}
+
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	qualities, err := client.GetMeetingQualitiesContext(ctx, db, id, 0)
+	if err != nil {
+		writeClientError(w, err)
+		return nil, false
+	}
+	if qualities == nil {
+		writeJSONError(w, http.StatusNotFound, types.ErrNoQualities.Error())
+		return nil, false
+	}
+
+	qualities.MeetingID = id
+	return qualities, true
+}
+
+// apiClient loads the WebexAPIClient of the access token, or else of the session, it must be allowed to use the feature.
+// Unlike the pages, the user is not redirected to the OAuth flow: the error is answered.
+func apiClient(w http.ResponseWriter, r *http.Request, host string, opts ClientOptions, sessions *sessionStore, tokens *tokenStore, features []Feature, feature Feature) (*WebexAPIClient, bool) {
+	var client *WebexAPIClient
+	if _, ok := bearerToken(r); ok {
+		var err error
+		if client, err = tokens.authenticate(r); err != nil {
+			if !errors.Is(err, errInvalidToken) {
+				log.Printf("error on authenticate(): %s\n", err.Error())
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeJSONError(w, http.StatusUnauthorized, errInvalidToken.Error())
+			return nil, false
+		}
+	} else {
+		var err error
+		if client, err = sessions.load(r); err != nil {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeJSONError(w, http.StatusUnauthorized, "Authenticate on the server first, or send a personal access token.")
+			return nil, false
+		}
+	}
+	client.Options = opts
+
+	if _, ok := featureByName(features, feature.Name); !ok {
+		writeJSONError(w, http.StatusForbidden, fmt.Sprintf("The %s feature is not enabled.", feature.Name))
+		return nil, false
+	}
+	if missing := client.MissingScopes(feature); len(missing) > 0 {
+		writeJSONError(w, http.StatusForbidden, fmt.Sprintf("The Webex authorization lacks the scopes %s, grant them at %s.",
+			strings.Join(missing, ", "), consentURL(host, feature)))
+		return nil, false
+	}
+
+	return client, true
+}
+
+// writeClientError answers the error of a WebexAPIClient call with the status it maps to.
+func writeClientError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	var rateLimited *RateLimitedError
+	var apiErr *APIError
+	switch {
+	case errors.Is(err, ErrRefreshTokenExpired):
+		status = http.StatusUnauthorized
+	case errors.As(err, &rateLimited):
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", strconv.Itoa(int(rateLimited.RetryAfter().Seconds()+1)))
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusForbidden):
+		// what Webex does not find or forbids is not found or forbidden here either
+		status = apiErr.StatusCode
+	}
+
+	body := types.ErrorResponse{Status: status, Message: err.Error()}
+	if errors.As(err, &apiErr) {
+		body.TrackingID = apiErr.TrackingID
+		log.Printf("Webex API error, trackingId: %s: %s\n", apiErr.TrackingID, err.Error())
+	}
+	writeJSON(w, status, body)
+}
+
+// writeJSONError answers a types.ErrorResponse.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, types.ErrorResponse{Status: status, Message: message})
+}
+
+// writeJSON answers v encoded as JSON.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("error on writeJSON(): %s\n", err.Error())
+	}
+}
@@ -0,0 +1,377 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"Webex.API.Integration.And.Visualization/types"
+	"Webex.API.Integration.And.Visualization/webextest"
+)
+
+// getJSON requests path with the browser's session and decodes the JSON body into v.
+func (a *testApp) getJSON(t *testing.T, path string, v interface{}) *http.Response {
+	t.Helper()
+
+	resp, err := a.browser.Get(a.server.URL + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("GET %s: want a JSON response, got %s", path, ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("GET %s: %v", path, err)
+	}
+	return resp
+}
+
+// wantJSONError checks the status of the response and of its types.ErrorResponse body.
+func wantJSONError(t *testing.T, resp *http.Response, body types.ErrorResponse, status int, message string) {
+	t.Helper()
+	if resp.StatusCode != status || body.Status != status {
+		t.Errorf("want status %d, got %d with body %+v", status, resp.StatusCode, body)
+	}
+	if !strings.Contains(body.Message, message) {
+		t.Errorf("want the message to contain %q, got %q", message, body.Message)
+	}
+}
+
+func TestAPIMeetings(t *testing.T) {
+	app := newTestApp(t)
+	meetings := app.webex.AddMeetings(3)
+	app.login(t)
+
+	var list types.MeetingsList
+	if resp := app.getJSON(t, "/api/v1/meetings", &list); resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s", resp.Status)
+	}
+	if len(list.Items) != len(meetings) {
+		t.Errorf("want %d meetings, got %d", len(meetings), len(list.Items))
+	}
+
+	var body types.ErrorResponse
+	resp := app.getJSON(t, "/api/v1/meetings?from=yesterday", &body)
+	wantJSONError(t, resp, body, http.StatusBadRequest, `invalid "from" parameter`)
+}
+
+func TestAPIQualitiesAndVisual(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	app.login(t)
+
+	var qualities types.MeetingQualities
+	if resp := app.getJSON(t, "/api/v1/meetings/"+meeting.ID+"/qualities", &qualities); resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s", resp.Status)
+	}
+	if want := app.webex.Qualities(meeting.ID); !reflect.DeepEqual(want.MediaSessions, qualities.MediaSessions) || qualities.MeetingID != meeting.ID {
+		t.Errorf("unexpected qualities for %s", qualities.MeetingID)
+	}
+
+	var visual types.VisualData
+	if resp := app.getJSON(t, "/api/v1/meetings/"+meeting.ID+"/visual?dp=video_out", &visual); resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s", resp.Status)
+	}
+	want, err := types.GetVisualData(&qualities, "video_out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(*want, visual) {
+		t.Errorf("want %+v, got %+v", *want, visual)
+	}
+
+	var body types.ErrorResponse
+	resp := app.getJSON(t, "/api/v1/meetings/"+meeting.ID+"/visual?dp=smell_in", &body)
+	wantJSONError(t, resp, body, http.StatusBadRequest, `Unknown data point "smell_in"`)
+}
+
+func TestAPIVisualByParticipant(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	generated := app.webex.Qualities(meeting.ID).MediaSessions
+
+	// the first participant joined again, the last one has no participant ID
+	first, second, last := generated[0], generated[1], generated[1]
+	last.ParticipantID = ""
+	last.Email = "guest@example.com"
+	app.webex.SetQualities(meeting.ID, &types.MeetingQualities{
+		MeetingID:     meeting.ID,
+		MediaSessions: []types.MediaSessionQuality{first, second, first, last},
+	})
+	app.login(t)
+
+	var visual types.VisualData
+	if resp := app.getJSON(t, "/api/v1/meetings/"+meeting.ID+"/visual?dp=audio_in", &visual); resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s", resp.Status)
+	}
+
+	want := []struct {
+		key      string
+		name     string
+		sessions []types.MediaSessionQuality
+	}{
+		{first.ParticipantID, first.DisplayName, []types.MediaSessionQuality{first, first}},
+		{second.ParticipantID, second.DisplayName, []types.MediaSessionQuality{second}},
+		{"guest@example.com", last.DisplayName, []types.MediaSessionQuality{last}},
+	}
+	if len(visual.Participants) != len(want) {
+		t.Fatalf("want %d participants, got %+v", len(want), visual.Participants)
+	}
+	for i, w := range want {
+		got := visual.Participants[i]
+		if got.Key != w.key || got.DisplayName != w.name || len(got.Sessions) != len(w.sessions) {
+			t.Errorf("participant %d: want %s (%s) with %d sessions, got %s (%s) with %d", i, w.key, w.name, len(w.sessions), got.Key, got.DisplayName, len(got.Sessions))
+			continue
+		}
+		for j, session := range w.sessions {
+			var packetLoss []types.Sample
+			for _, data := range session.AudioIn {
+				start, _ := time.Parse(time.RFC3339, data.StartTime)
+				for k, value := range data.PacketLoss {
+					packetLoss = append(packetLoss, types.Sample{Time: start.Add(time.Duration(k*data.SamplingInterval) * time.Second), Value: value})
+				}
+			}
+			if !reflect.DeepEqual(packetLoss, got.Sessions[j].PacketLoss) {
+				t.Errorf("participant %d session %d: want the packet loss of the session, got %v", i, j, got.Sessions[j].PacketLoss)
+			}
+			if got.Sessions[j].StartTime != session.AudioIn[0].StartTime {
+				t.Errorf("participant %d session %d: want start time %s, got %s", i, j, session.AudioIn[0].StartTime, got.Sessions[j].StartTime)
+			}
+		}
+	}
+}
+
+func TestAPIVisualTimestamps(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+
+	// the participant lost the audio from 10:02 to 10:05
+	interval := func(start, end string, values ...float32) types.MediaQualityData {
+		return types.MediaQualityData{SamplingInterval: 60, StartTime: start, EndTime: end, PacketLoss: values, Latency: values, Jitter: values}
+	}
+	session := types.MediaSessionQuality{
+		ParticipantID: "participant",
+		DisplayName:   "Participant",
+		VideoIn:       []types.MediaQualityData{interval("2024-03-01T10:00:00Z", "2024-03-01T10:07:00Z")},
+		AudioIn: []types.MediaQualityData{
+			interval("2024-03-01T10:00:00Z", "2024-03-01T10:02:00Z", 1, 2),
+			interval("2024-03-01T10:05:00Z", "2024-03-01T10:07:00Z", 3, 4),
+		},
+	}
+	app.webex.SetQualities(meeting.ID, &types.MeetingQualities{MeetingID: meeting.ID, MediaSessions: []types.MediaSessionQuality{session}})
+	app.login(t)
+
+	var visual types.VisualData
+	if resp := app.getJSON(t, "/api/v1/meetings/"+meeting.ID+"/visual?dp=audio_in", &visual); resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s", resp.Status)
+	}
+	if len(visual.Participants) != 1 || len(visual.Participants[0].Sessions) != 1 {
+		t.Fatalf("want a participant with a session, got %+v", visual.Participants)
+	}
+
+	got := visual.Participants[0].Sessions[0]
+	at := func(s string) time.Time {
+		parsed, _ := time.Parse(time.RFC3339, s)
+		return parsed
+	}
+	want := []types.Sample{
+		{Time: at("2024-03-01T10:00:00Z"), Value: 1},
+		{Time: at("2024-03-01T10:01:00Z"), Value: 2},
+		{Time: at("2024-03-01T10:05:00Z"), Value: 3},
+		{Time: at("2024-03-01T10:06:00Z"), Value: 4},
+	}
+	if !reflect.DeepEqual(want, got.Jitter) {
+		t.Errorf("want the samples timestamped with the gap kept, got %+v", got.Jitter)
+	}
+	if got.SamplingInterval != 60 {
+		t.Errorf("want a sampling interval of 60s, got %d", got.SamplingInterval)
+	}
+}
+
+func TestAPIVisualMetrics(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+
+	// the participant fell back from UDP to TCP, then switched codec
+	interval := func(start, end, codec, transport string, height float32) types.MediaQualityData {
+		return types.MediaQualityData{
+			SamplingInterval: 60,
+			StartTime:        start,
+			EndTime:          end,
+			PacketLoss:       []float32{1},
+			MediaBitRate:     []float32{height * 1000},
+			ResolutionHeight: []float32{height},
+			FrameRate:        []float32{30},
+			Codec:            codec,
+			TransportType:    transport,
+		}
+	}
+	video := []types.MediaQualityData{
+		interval("2024-03-01T10:00:00Z", "2024-03-01T10:01:00Z", "H.264", "UDP", 720),
+		interval("2024-03-01T10:01:00Z", "2024-03-01T10:02:00Z", "H.264", "UDP", 720),
+		interval("2024-03-01T10:02:00Z", "2024-03-01T10:03:00Z", "H.264", "TCP", 360),
+		interval("2024-03-01T10:03:00Z", "2024-03-01T10:04:00Z", "AV1", "TCP", 1080),
+	}
+	app.webex.SetQualities(meeting.ID, &types.MeetingQualities{MeetingID: meeting.ID, MediaSessions: []types.MediaSessionQuality{
+		{ParticipantID: "participant", VideoIn: video},
+	}})
+	app.login(t)
+
+	var visual types.VisualData
+	if resp := app.getJSON(t, "/api/v1/meetings/"+meeting.ID+"/visual?dp=video_in", &visual); resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s", resp.Status)
+	}
+	if len(visual.Participants) != 1 || len(visual.Participants[0].Sessions) != 1 {
+		t.Fatalf("want a participant with a session, got %+v", visual.Participants)
+	}
+	got := visual.Participants[0].Sessions[0]
+
+	values := func(samples []types.Sample) []float32 {
+		var values []float32
+		for _, sample := range samples {
+			values = append(values, sample.Value)
+		}
+		return values
+	}
+	if want := []float32{720000, 720000, 360000, 1080000}; !reflect.DeepEqual(want, values(got.MediaBitRate)) {
+		t.Errorf("want bit rates %v, got %v", want, values(got.MediaBitRate))
+	}
+	if want := []float32{720, 720, 360, 1080}; !reflect.DeepEqual(want, values(got.ResolutionHeight)) {
+		t.Errorf("want resolutions %v, got %v", want, values(got.ResolutionHeight))
+	}
+	if want := []float32{30, 30, 30, 30}; !reflect.DeepEqual(want, values(got.FrameRate)) {
+		t.Errorf("want frame rates %v, got %v", want, values(got.FrameRate))
+	}
+
+	var changes []string
+	for _, change := range got.Changes {
+		changes = append(changes, change.Time.Format("15:04")+" "+change.Codec+" "+change.TransportType)
+	}
+	if want := []string{"10:00 H.264 UDP", "10:02 H.264 TCP", "10:03 AV1 TCP"}; !reflect.DeepEqual(want, changes) {
+		t.Errorf("want changes %v, got %v", want, changes)
+	}
+}
+
+func TestAPIVisualResources(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	qualities := app.webex.Qualities(meeting.ID)
+	app.login(t)
+
+	var visual types.VisualData
+	if resp := app.getJSON(t, "/api/v1/meetings/"+meeting.ID+"/visual?dp=resources", &visual); resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200, got %s", resp.Status)
+	}
+	if len(visual.Participants) != len(qualities.MediaSessions) {
+		t.Fatalf("want the resources of %d participants, got %d", len(qualities.MediaSessions), len(visual.Participants))
+	}
+
+	for i, session := range qualities.MediaSessions {
+		got := visual.Participants[i].Sessions[0]
+		if len(got.PacketLoss) != 0 || len(got.ProcessAverageCPU) == 0 {
+			t.Errorf("participant %d: want the CPU usage only, got %+v", i, got)
+			continue
+		}
+
+		// the CPU usage is sampled at the same time as the audio
+		var audio []types.Sample
+		for _, data := range session.AudioIn {
+			start, _ := time.Parse(time.RFC3339, data.StartTime)
+			for k := range data.PacketLoss {
+				audio = append(audio, types.Sample{Time: start.Add(time.Duration(k*data.SamplingInterval) * time.Second)})
+			}
+		}
+		for _, series := range [][]types.Sample{got.ProcessAverageCPU, got.ProcessMaxCPU, got.SystemAverageCPU, got.SystemMaxCPU} {
+			if len(series) != len(audio) {
+				t.Errorf("participant %d: want %d CPU samples, got %d", i, len(audio), len(series))
+				continue
+			}
+			for k := range series {
+				if !series[k].Time.Equal(audio[k].Time) {
+					t.Errorf("participant %d: want CPU sample %d at %s, got %s", i, k, audio[k].Time, series[k].Time)
+				}
+			}
+		}
+		if got.SystemMaxCPU[0].Value < got.SystemAverageCPU[0].Value {
+			t.Errorf("participant %d: want the max above the average CPU, got %+v", i, got)
+		}
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+
+	// without a session
+	var body types.ErrorResponse
+	resp := app.getJSON(t, "/api/v1/meetings", &body)
+	wantJSONError(t, resp, body, http.StatusUnauthorized, "Authenticate")
+
+	app.login(t)
+
+	tests := []struct {
+		name     string
+		path     string
+		script   []webextest.Response
+		status   int
+		message  string
+		tracking bool
+	}{
+		{name: "unknown endpoint", path: "/api/v1/recordings", status: http.StatusNotFound, message: "No API endpoint"},
+		{name: "missing meeting ID", path: "/api/v1/meetings//qualities", status: http.StatusNotFound, message: "No API endpoint"},
+		{name: "no qualities", path: "/api/v1/meetings/" + meeting.ID + "/qualities", script: []webextest.Response{{Status: http.StatusNoContent}}, status: http.StatusNotFound, message: types.ErrNoQualities.Error()},
+		{name: "unknown at Webex", path: "/api/v1/meetings/" + meeting.ID + "/qualities", script: []webextest.Response{{Status: http.StatusNotFound}}, status: http.StatusNotFound, message: "Not Found", tracking: true},
+		{name: "Webex failure", path: "/api/v1/meetings/" + meeting.ID + "/visual", script: []webextest.Response{{Status: http.StatusBadRequest}}, status: http.StatusBadGateway, message: "Bad Request", tracking: true},
+		{name: "rate limited", path: "/api/v1/meetings/" + meeting.ID + "/qualities", script: []webextest.Response{{Status: http.StatusTooManyRequests, RetryAfter: 5 * time.Minute}}, status: http.StatusTooManyRequests, message: "rate limit", tracking: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app.webex.ScriptQualities(meeting.ID, test.script...)
+
+			var body types.ErrorResponse
+			resp := app.getJSON(t, test.path, &body)
+			wantJSONError(t, resp, body, test.status, test.message)
+			if test.tracking && body.TrackingID == "" {
+				t.Errorf("want the Webex tracking ID, got %+v", body)
+			}
+			if test.status == http.StatusTooManyRequests && resp.Header.Get("Retry-After") == "" {
+				t.Errorf("want a Retry-After header")
+			}
+		})
+	}
+
+	// only GET is allowed
+	resp, err := app.browser.Post(app.server.URL+"/api/v1/meetings", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodGet {
+		t.Errorf("want 405 with the allowed methods, got %s", resp.Status)
+	}
+}
+
+func TestAPIMissingScopes(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	app.webex.DenyScopes("analytics:read_all")
+	resp, err := app.browser.PostForm(app.server.URL+"/init", map[string][]string{"integration": {testClientID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the API does not redirect to the consent flow, it tells where to grant the scopes
+	var body types.ErrorResponse
+	resp = app.getJSON(t, "/api/v1/meetings/"+meeting.ID+"/qualities", &body)
+	wantJSONError(t, resp, body, http.StatusForbidden, "lacks the scopes analytics:read_all, grant them at "+app.server.URL+"/consent?feature=analytics")
+	if calls := app.webex.Calls("/analytics/v1/meeting/qualities"); calls != 0 {
+		t.Errorf("want Webex not asked, got %d requests", calls)
+	}
+}
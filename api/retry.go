@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how requests that Webex could not serve for now are retried.
+// Responses with the status 429, 502, 503 or 504 are retried with a jittered exponential backoff,
+// a longer Retry-After sent by Webex is honoured. The requests to the token endpoint are not repeated,
+// they are only retried on a 429 with a Retry-After. The zero value uses DefaultRetryPolicy.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent, including the first one. 1 disables retries.
+	MaxAttempts int
+	// BaseDelay is the backoff before the first retry, it doubles on every following retry.
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff between two attempts.
+	MaxDelay time.Duration
+	// MaxWait caps the total time spent waiting between attempts.
+	// A request that would need to wait longer is given up, a 429 then results in a RateLimitedError.
+	MaxWait time.Duration
+}
+
+// RATE_LIMIT_FLOOR is how long Webex is assumed to refuse requests after a 429 sent without a Retry-After header.
+// Webex rate limits its APIs per minute, so retrying sooner than that is not worth it.
+const RATE_LIMIT_FLOOR = time.Minute
+
+// DefaultRetryPolicy is used when the ClientOptions carry no retry policy.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   500 * time.Millisecond,
+		MaxDelay:    10 * time.Second,
+		MaxWait:     30 * time.Second,
+	}
+}
+
+// RateLimitedError is returned when Webex keeps answering 429 Too Many Requests.
+// The meeting qualities for instance can only be requested once every 5 minutes.
+type RateLimitedError struct {
+	// RetryAt is the time from which Webex is expected to accept the request again.
+	RetryAt time.Time
+	// Err is the last 429 response of Webex.
+	Err *APIError
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("Webex API rate limit reached, available in %s", e.RetryAfter())
+}
+
+// Unwrap returns the last 429 response of Webex, so its tracking ID can be retrieved with errors.As.
+func (e *RateLimitedError) Unwrap() error {
+	if e.Err == nil {
+		return nil
+	}
+	return e.Err
+}
+
+// RetryAfter is the time left until the request can be made again.
+func (e *RateLimitedError) RetryAfter() time.Duration {
+	d := time.Until(e.RetryAt).Round(time.Second)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// retryable tells whether a response is worth sending the request again.
+func retryable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// rejected tells whether Webex turned the request down without processing it, a 429 with a Retry-After header.
+// Requests that must not be repeated, like the exchange of an OAuth code, are only retried then.
+func rejected(resp *http.Response) bool {
+	return resp.StatusCode == http.StatusTooManyRequests && resp.Header.Get("Retry-After") != ""
+}
+
+var (
+	jitterMu sync.Mutex
+	jitter   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// backoff is the jittered delay before the given retry, the first retry being 1.
+// The delay is drawn from the upper half of the exponential backoff so retries are spread out but never immediate.
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	jitterMu.Lock()
+	defer jitterMu.Unlock()
+	return delay/2 + time.Duration(jitter.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter reads the Retry-After header, given either in seconds or as an HTTP date.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if at, err := http.ParseTime(header); err == nil {
+		if d := at.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+
+	return 0, false
+}
+
+func (o ClientOptions) retryPolicy() RetryPolicy {
+	if o.Retry.MaxAttempts == 0 {
+		return DefaultRetryPolicy()
+	}
+	return o.Retry
+}
+
+// do sends the request built by newReq, sending it again as the retry policy allows.
+// newReq is called for every attempt so the request body can be read again.
+// The last response is returned when it is not retryable or the attempts are exhausted,
+// except for a 429 which results in a RateLimitedError.
+func (o ClientOptions) do(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	return o.send(ctx, newReq, retryable)
+}
+
+// doOnce sends the request built by newReq like do, but only sends it again when Webex rejected it.
+// It is used for the requests to the token endpoint: a code can only be exchanged once,
+// and a refresh token may be rotated by a refresh whose response got lost.
+func (o ClientOptions) doOnce(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	return o.send(ctx, newReq, rejected)
+}
+
+// send sends the request built by newReq, sending it again as the retry policy allows while retry holds for the response.
+func (o ClientOptions) send(ctx context.Context, newReq func() (*http.Request, error), retry func(*http.Response) bool) (*http.Response, error) {
+	policy := o.retryPolicy()
+	client := o.httpClient()
+
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		wait := policy.backoff(attempt)
+		retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now)
+		if ok && retryAfter > wait {
+			wait = retryAfter
+		}
+
+		if !retry(resp) || attempt >= policy.MaxAttempts || waited+wait > policy.MaxWait {
+			if resp.StatusCode != http.StatusTooManyRequests {
+				return resp, nil
+			}
+
+			// without a Retry-After the backoff says nothing about when Webex accepts the request again
+			if !ok && wait < RATE_LIMIT_FLOOR {
+				wait = RATE_LIMIT_FLOOR
+			}
+			defer resp.Body.Close()
+			return nil, &RateLimitedError{RetryAt: now.Add(wait), Err: newAPIError(resp)}
+		}
+		discard(resp)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		waited += wait
+	}
+}
+
+// discard drains and closes the body so the connection can be reused.
+func discard(resp *http.Response) {
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	resp.Body.Close()
+}
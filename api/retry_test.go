@@ -0,0 +1,133 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 4, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "missing", header: "", want: 0, wantOk: false},
+		{name: "seconds", header: "312", want: 312 * time.Second, wantOk: true},
+		{name: "HTTP date", header: "Fri, 01 Apr 2022 10:05:00 GMT", want: 5 * time.Minute, wantOk: true},
+		{name: "HTTP date in the past", header: "Fri, 01 Apr 2022 09:55:00 GMT", want: 0, wantOk: true},
+		{name: "negative", header: "-1", want: 0, wantOk: false},
+		{name: "garbage", header: "soon", want: 0, wantOk: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(test.header, now)
+			if got != test.want || ok != test.wantOk {
+				t.Errorf("want: %s, %v but got: %s, %v", test.want, test.wantOk, got, ok)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for retry, ceiling := range map[int]time.Duration{
+		1: 100 * time.Millisecond,
+		2: 200 * time.Millisecond,
+		3: 400 * time.Millisecond,
+		4: 800 * time.Millisecond,
+		5: time.Second,
+		9: time.Second,
+	} {
+		for i := 0; i < 20; i++ {
+			if got := policy.backoff(retry); got < ceiling/2 || got > ceiling {
+				t.Errorf("retry %d: want backoff within [%s, %s], got %s", retry, ceiling/2, ceiling, got)
+			}
+		}
+	}
+}
+
+func TestRateLimitedErrorMessage(t *testing.T) {
+	err := &RateLimitedError{RetryAt: time.Now().Add(3*time.Minute + 12*time.Second + 300*time.Millisecond)}
+	if want := "Webex API rate limit reached, available in 3m12s"; err.Error() != want {
+		t.Errorf("want: %s but got: %s", want, err.Error())
+	}
+}
+
+// scriptedServer answers the requests with the statuses in order, the last one repeatedly, and counts them.
+func scriptedServer(t *testing.T, retryAfter string, statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1))
+		if n > len(statuses) {
+			n = len(statuses)
+		}
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(statuses[n-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestDoOnceRetriesOnlyRejectedRequests(t *testing.T) {
+	opts := ClientOptions{Retry: RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxWait: time.Second}}
+	ctx := context.Background()
+
+	tests := []struct {
+		name       string
+		retryAfter string
+		statuses   []int
+		do         func(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error)
+		want       int32
+	}{
+		{name: "do retries a 503", statuses: []int{503, 200}, do: opts.do, want: 2},
+		{name: "doOnce sends a 503 once", statuses: []int{503, 200}, do: opts.doOnce, want: 1},
+		{name: "doOnce sends a 502 once", statuses: []int{502, 200}, do: opts.doOnce, want: 1},
+		{name: "doOnce sends a 429 without Retry-After once", statuses: []int{429, 200}, do: opts.doOnce, want: 1},
+		{name: "doOnce retries a 429 with Retry-After", retryAfter: "0", statuses: []int{429, 200}, do: opts.doOnce, want: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server, calls := scriptedServer(t, test.retryAfter, test.statuses...)
+			resp, err := test.do(ctx, func() (*http.Request, error) {
+				return opts.newRequest(ctx, http.MethodPost, server.URL, nil)
+			})
+			if err == nil {
+				resp.Body.Close()
+			}
+			if got := atomic.LoadInt32(calls); got != test.want {
+				t.Errorf("want %d requests, got %d", test.want, got)
+			}
+		})
+	}
+}
+
+func TestRateLimitedWithoutRetryAfter(t *testing.T) {
+	opts := ClientOptions{Retry: RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, MaxWait: time.Second}}
+	server, _ := scriptedServer(t, "", http.StatusTooManyRequests)
+
+	ctx := context.Background()
+	_, err := opts.do(ctx, func() (*http.Request, error) {
+		return opts.newRequest(ctx, http.MethodGet, server.URL, nil)
+	})
+
+	// the backoff of a millisecond does not tell when Webex accepts requests again
+	var rateLimited *RateLimitedError
+	if !errors.As(err, &rateLimited) {
+		t.Fatalf("want a RateLimitedError, got %v", err)
+	}
+	if got := rateLimited.RetryAfter(); got < RATE_LIMIT_FLOOR-time.Second {
+		t.Errorf("want to retry after at least %s, got %s", RATE_LIMIT_FLOOR, got)
+	}
+}
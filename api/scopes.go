@@ -0,0 +1,165 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// Feature is a part of the application backed by Webex data, it needs its scopes to be granted.
+type Feature struct {
+	Name        string
+	Description string
+	Scopes      []string
+}
+
+// Features of the application, their scopes are requested when they are enabled.
+var (
+	FEATURE_MEETINGS = Feature{
+		Name:        "meetings",
+		Description: "List the meetings of the account",
+		Scopes:      []string{"meeting:schedules_read"},
+	}
+	FEATURE_ANALYTICS = Feature{
+		Name:        "analytics",
+		Description: "Visualize and download the media qualities of the meetings",
+		Scopes:      []string{"analytics:read_all"},
+	}
+)
+
+// BASE_SCOPES are requested on every OAuth flow whichever the features, they identify the user who logs in.
+var BASE_SCOPES = []string{"spark:people_read"}
+
+// FEATURES are all the features of the application, they are all enabled by default.
+var FEATURES = []Feature{FEATURE_MEETINGS, FEATURE_ANALYTICS}
+
+// ParseFeatures parses a comma separated list of feature names.
+func ParseFeatures(value string) ([]Feature, error) {
+	features := []Feature{}
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		feature, ok := featureByName(FEATURES, name)
+		if !ok {
+			return nil, fmt.Errorf("unknown feature %q", name)
+		}
+		features = append(features, feature)
+	}
+
+	if len(features) == 0 {
+		return nil, fmt.Errorf("no feature enabled")
+	}
+	return features, nil
+}
+
+// LoadFeatures returns the features of the names, all of them if there is none.
+func LoadFeatures(names []string) ([]Feature, error) {
+	if len(names) == 0 {
+		return FEATURES, nil
+	}
+
+	features, err := ParseFeatures(strings.Join(names, ","))
+	if err != nil {
+		return nil, fmt.Errorf("invalid features: %w", err)
+	}
+	return features, nil
+}
+
+func featureByName(features []Feature, name string) (Feature, bool) {
+	for _, feature := range features {
+		if feature.Name == name {
+			return feature, true
+		}
+	}
+	return Feature{}, false
+}
+
+// requestedScopes are the scopes of the enabled features that the integration was created with.
+// An integration registered without scopes is assumed to have them all.
+func requestedScopes(features []Feature, integration *types.Integration) []string {
+	scopes := []string{}
+	for _, feature := range features {
+		for _, scope := range feature.Scopes {
+			if len(integration.Scopes) == 0 || hasScope(integration.Scopes, scope) {
+				scopes = addScope(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// GrantedScopes are the scopes Webex granted to the access token, nil when Webex did not tell.
+func (c *WebexAPIClient) GrantedScopes() []string {
+	if c.Auth.Scope == "" {
+		return nil
+	}
+	return strings.Fields(c.Auth.Scope)
+}
+
+// MissingScopes are the scopes of the feature that were not granted.
+// Nothing is missing when the granted scopes are unknown, the Webex API then tells with a 403.
+func (c *WebexAPIClient) MissingScopes(feature Feature) []string {
+	granted := c.GrantedScopes()
+	if granted == nil {
+		return nil
+	}
+	return missingScopes(granted, feature.Scopes)
+}
+
+// missingScopes are the requested scopes that are not granted, granted being a list of scopes.
+func missingScopes(granted, requested []string) []string {
+	missing := []string{}
+	for _, scope := range requested {
+		if !hasScope(granted, scope) {
+			missing = addScope(missing, scope)
+		}
+	}
+	return missing
+}
+
+// unavailableFeatures are the enabled features that cannot be used without the missing scopes.
+func unavailableFeatures(features []Feature, missing []string) []string {
+	names := []string{}
+	for _, feature := range features {
+		for _, scope := range feature.Scopes {
+			if hasScope(missing, scope) {
+				names = append(names, feature.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func addScope(scopes []string, scope string) []string {
+	if hasScope(scopes, scope) {
+		return scopes
+	}
+	return append(scopes, scope)
+}
+
+// unionScopes merges the scopes, sorted so the same set is always requested the same way.
+func unionScopes(sets ...[]string) []string {
+	scopes := []string{}
+	for _, set := range sets {
+		for _, scope := range set {
+			scopes = addScope(scopes, scope)
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
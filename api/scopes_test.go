@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"Webex.API.Integration.And.Visualization/types"
+	"Webex.API.Integration.And.Visualization/webextest"
+)
+
+func TestParseFeatures(t *testing.T) {
+	features, err := ParseFeatures(" analytics , meetings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(features, []Feature{FEATURE_ANALYTICS, FEATURE_MEETINGS}) {
+		t.Errorf("unexpected features %+v", features)
+	}
+
+	for _, invalid := range []string{"", " , ", "meetings,recordings"} {
+		if _, err := ParseFeatures(invalid); err == nil {
+			t.Errorf("want an error for %q", invalid)
+		}
+	}
+}
+
+func TestRequestedScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		features []Feature
+		scopes   []string
+		want     []string
+	}{
+		{name: "all features", features: FEATURES, scopes: DEFAULT_SCOPES, want: []string{"meeting:schedules_read", "analytics:read_all"}},
+		{name: "enabled features only", features: []Feature{FEATURE_MEETINGS}, scopes: DEFAULT_SCOPES, want: []string{"meeting:schedules_read"}},
+		{name: "integration scopes only", features: FEATURES, scopes: []string{"analytics:read_all"}, want: []string{"analytics:read_all"}},
+		{name: "integration without scopes", features: FEATURES, want: []string{"meeting:schedules_read", "analytics:read_all"}},
+		{name: "no scope in common", features: []Feature{FEATURE_MEETINGS}, scopes: []string{"analytics:read_all"}, want: []string{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := requestedScopes(test.features, &types.Integration{Scopes: test.scopes})
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("want %v, got %v", test.want, got)
+			}
+		})
+	}
+}
+
+func TestMissingScopes(t *testing.T) {
+	client := &WebexAPIClient{}
+	if missing := client.MissingScopes(FEATURE_ANALYTICS); len(missing) != 0 {
+		t.Errorf("want nothing missing when the granted scopes are unknown, got %v", missing)
+	}
+
+	client.Auth.Scope = "meeting:schedules_read spark:kms"
+	if missing := client.MissingScopes(FEATURE_MEETINGS); len(missing) != 0 {
+		t.Errorf("want nothing missing, got %v", missing)
+	}
+	if missing := client.MissingScopes(FEATURE_ANALYTICS); !reflect.DeepEqual(missing, []string{"analytics:read_all"}) {
+		t.Errorf("want analytics:read_all missing, got %v", missing)
+	}
+}
+
+func TestAuthReportsMissingScopes(t *testing.T) {
+	app := newTestApp(t)
+	app.webex.DenyScopes("analytics:read_all")
+
+	resp, err := app.browser.PostForm(app.server.URL+"/init", url.Values{"integration": {testClientID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := readBody(t, resp)
+
+	if resp.Request.URL.Path != "/message" || !strings.Contains(body, "did not grant the scopes: analytics:read_all") ||
+		!strings.Contains(body, "Unavailable features: analytics") {
+		t.Errorf("want the missing scopes reported, ended at %s with: %s", resp.Request.URL, body)
+	}
+
+	// the granted scopes can still be used
+	if got := app.sessionClient(t).GrantedScopes(); !reflect.DeepEqual(got, []string{"meeting:schedules_read", "spark:people_read"}) {
+		t.Errorf("want meeting:schedules_read and spark:people_read granted, got %v", got)
+	}
+	if resp, body := app.get(t, "/get_meetings_page"); resp.Request.URL.Path != "/get_meetings_page" {
+		t.Errorf("want the meetings page, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func TestAuthWithoutPeopleRead(t *testing.T) {
+	app := newTestApp(t)
+	app.webex.DenyScopes("spark:people_read")
+
+	// the user who logs in cannot be identified without the scope
+	resp, err := app.browser.PostForm(app.server.URL+"/init", url.Values{"integration": {testClientID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := readBody(t, resp)
+
+	if resp.Request.URL.Path != "/error" || !strings.Contains(body, "did not grant the spark:people_read scope") {
+		t.Errorf("want the error page, ended at %s with: %s", resp.Request.URL, body)
+	}
+	if data, err := app.db.RetrieveCredentials(testClientID, webextest.DEFAULT_PERSON_ID); err != nil || data != "" {
+		t.Errorf("want no credentials saved, got %q, %v", data, err)
+	}
+}
+
+func TestIncrementalConsent(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	app.webex.DenyScopes("analytics:read_all")
+	resp, err := app.browser.PostForm(app.server.URL+"/init", url.Values{"integration": {testClientID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readBody(t, resp)
+
+	// the user grants the missing scope when the feature is used
+	app.webex.AllowScopes("analytics:read_all")
+	authorizations := app.webex.Calls("/v1/authorize")
+	resp, body := app.get(t, "/get_analytics_page?id="+meeting.ID)
+	if resp.Request.URL.Path != "/message" || !strings.Contains(body, "Successfully authenticated") {
+		t.Fatalf("want the consent flow completed, ended at %s with: %s", resp.Request.URL, body)
+	}
+	if got := app.webex.Calls("/v1/authorize"); got != authorizations+1 {
+		t.Errorf("want 1 authorization, got %d", got-authorizations)
+	}
+
+	// the previously granted scopes are kept
+	if got := app.sessionClient(t).GrantedScopes(); !reflect.DeepEqual(got, []string{"analytics:read_all", "meeting:schedules_read", "spark:people_read"}) {
+		t.Errorf("want all the scopes granted, got %v", got)
+	}
+	if resp, body := app.get(t, "/get_analytics_page?id="+meeting.ID); resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/get_analytics_page" {
+		t.Errorf("want the analytics page, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func TestConsentIntegrationLacksScope(t *testing.T) {
+	app := newTestApp(t)
+	err := app.db.SaveIntegration(types.Integration{
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		Scopes:       []string{"meeting:schedules_read"},
+		Label:        "Meetings only",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.login(t)
+
+	resp, body := app.get(t, "/get_analytics_page?id=some-meeting")
+	if resp.Request.URL.Path != "/error" || !strings.Contains(body, "was not created with the scopes analytics:read_all") {
+		t.Errorf("want the error page, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func TestFeatureURL(t *testing.T) {
+	client := &WebexAPIClient{Auth: types.AuthResponse{Scope: "meeting:schedules_read"}}
+
+	if got := featureURL("http://host", client, FEATURES, FEATURE_MEETINGS); got != "" {
+		t.Errorf("want no redirect, got %s", got)
+	}
+	if got := featureURL("http://host", client, FEATURES, FEATURE_ANALYTICS); got != "http://host/consent?feature=analytics" {
+		t.Errorf("want the consent redirect, got %s", got)
+	}
+	if got := featureURL("http://host", client, []Feature{FEATURE_MEETINGS}, FEATURE_ANALYTICS); !strings.HasPrefix(got, "http://host/error") {
+		t.Errorf("want the error page for a disabled feature, got %s", got)
+	}
+}
@@ -1,45 +1,126 @@
 package api
 
 import (
-	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"net"
 	"net/http"
 	"net/url"
-	"os"
 	"strings"
-	"text/template"
+	"time"
 
+	"Webex.API.Integration.And.Visualization/config"
 	"Webex.API.Integration.And.Visualization/persist"
 	"Webex.API.Integration.And.Visualization/types"
 )
 
-// WebexApplicationServer is the server for the Webex Application.
-func WebexApplicationServer(db *persist.Persist) error {
-	// load the server's host
-	host := os.Getenv("HOST")
-	if host == "" {
-		return fmt.Errorf("HOST environment variable is not set")
+// REQUEST_TIMEOUT bounds the Webex API calls made while handling a single request.
+const REQUEST_TIMEOUT = 60 * time.Second
+
+const (
+	// OAUTH_REQUEST_COOKIE holds the OAuth request between "/init" and the redirect to "/auth".
+	OAUTH_REQUEST_COOKIE = "OAuthRequest"
+	// OAUTH_REQUEST_TTL is how long the user has to complete the OAuth flow.
+	OAUTH_REQUEST_TTL = 10 * time.Minute
+)
+
+// SHUTDOWN_TIMEOUT bounds how long in-flight requests are drained on shutdown.
+const SHUTDOWN_TIMEOUT = 30 * time.Second
+
+// Server is the server for the Webex Application, it serves its pages with its own ServeMux.
+type Server struct {
+	db       *persist.Persist
+	cfg      *config.Config
+	host     string
+	opts     ClientOptions
+	codec    *CookieCodec
+	sessions *sessionStore
+	tokens   *tokenStore
+	features []Feature
+	pages    *pageTemplates
+	mux      *http.ServeMux
+}
+
+// NewServer creates the server for the Webex Application configured by cfg.
+// The integrations of the configuration are registered in db, which is closed when Run returns.
+func NewServer(db *persist.Persist, cfg *config.Config) (*Server, error) {
+	// the server's host and where the Webex API is reached
+	s := &Server{
+		db:   db,
+		cfg:  cfg,
+		host: cfg.Host,
+		opts: ClientOptionsFromConfig(cfg),
+		mux:  http.NewServeMux(),
+	}
+	// parse the HTML templates, read from the template directory in dev mode
+	var err error
+	templateDir := ""
+	if cfg.Dev {
+		templateDir = cfg.TemplateDir
+	}
+	if s.pages, err = newPageTemplates(templateDir); err != nil {
+		return nil, err
+	}
+
+	// load the enabled features, their scopes are requested to Webex
+	if s.features, err = LoadFeatures(cfg.Features); err != nil {
+		return nil, err
+	}
+
+	// register the Webex integrations the users can authorize, the ones no longer configured are unregistered
+	integrations := IntegrationsFromConfig(cfg)
+	if cfg.IntegrationsFile != "" {
+		fromFile, err := LoadIntegrationsFile(cfg.IntegrationsFile)
+		if err != nil {
+			return nil, err
+		}
+		integrations = append(integrations, fromFile...)
+		log.Printf("registering %d Webex integrations from %s\n", len(fromFile), cfg.IntegrationsFile)
+	}
+	if err := SyncIntegrations(db, integrations); err != nil {
+		return nil, err
+	}
+
+	// load the keys the cookies are sealed with
+	if s.codec, err = LoadCookieCodec(cfg.Cookies.Keys, cfg.Cookies.KeyFile); err != nil {
+		return nil, err
 	}
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "./templates/index.html")
+	// the users' WebexAPIClients are kept server-side
+	s.sessions = newSessionStore(db, s.host, cfg.Cache.SessionTTL.Duration, s.codec)
+	s.tokens = newTokenStore(db)
+
+	s.routes()
+	return s, nil
+}
+
+// routes registers the handlers of the server on its ServeMux.
+func (s *Server) routes() {
+	db, host, opts, codec, sessions, tokens, features, pages := s.db, s.host, s.opts, s.codec, s.sessions, s.tokens, s.features, s.pages
+
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if err := indexPage(w, pages, db); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	})
-	http.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+	s.mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
 		// The request will be like so: http://your-server.com/error?msg=<ErrorMsg>
 		errorMsg := r.URL.Query().Get("msg")
 		if errorMsg == "" {
 			errorMsg = "Unknown error"
 		}
 
-		if err := errorPage(w, errorMsg); err != nil {
+		if err := errorPage(w, pages, errorMsg); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	})
-	http.HandleFunc("/message", func(w http.ResponseWriter, r *http.Request) {
+	s.mux.HandleFunc("/message", func(w http.ResponseWriter, r *http.Request) {
 		// The request will be like so: http://your-server.com/message?msg=<Msg>
 		msg := r.URL.Query().Get("msg")
 		apiRedirect := true
@@ -47,181 +128,378 @@ func WebexApplicationServer(db *persist.Persist) error {
 			msg = "Unknown message"
 			apiRedirect = false
 		}
-		if err := messagePage(w, msg, apiRedirect); err != nil {
+		if err := messagePage(w, pages, msg, apiRedirect); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	})
-	http.HandleFunc("/init", init_flow(host))
+	s.mux.HandleFunc("/init", init_flow(db, host, opts, codec, pages, features))
+	s.mux.HandleFunc("/consent", consent(db, host, opts, codec, sessions, features))
 
 	// "/auth" is called by Webex on redirect from the OAuth flow.
-	http.HandleFunc("/auth", auth(host))
+	s.mux.HandleFunc("/auth", auth(db, host, opts, codec, sessions, features))
 
-	http.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
-		// check if cookie exists for API calls
-		_, err := r.Cookie("WebexAPIClient")
-		if err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+	s.mux.HandleFunc("/api", func(w http.ResponseWriter, r *http.Request) {
+		// check if a session exists for API calls
+		if _, err := sessions.load(r); err != nil {
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
 
 		// display all APIs calls page
-		http.ServeFile(w, r, "./templates/api_calls.html")
+		if err := pages.render(w, "api_calls.html", nil); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 	})
-	http.HandleFunc("/get_meetings_page", getMeetings(host))
-	http.HandleFunc("/get_analytics_page", analyticsVisualization(db, host))
-	http.HandleFunc("/get_analytics_file", dowloadAnalyticsFile(db, host))
-	http.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+	// the JSON API, errors are answered as JSON instead of redirecting to the error page
+	s.mux.HandleFunc(API_V1_PREFIX+"/", apiV1(db, host, opts, sessions, tokens, features))
+	s.mux.HandleFunc(OPENAPI_PATH, openAPI)
+
+	// the personal access tokens of the JSON API
+	s.mux.HandleFunc("/settings", settings(host, sessions, tokens, pages))
+	s.mux.HandleFunc("/settings/revoke", revokeToken(host, sessions, tokens))
+
+	s.mux.HandleFunc("/get_meetings_page", getMeetings(host, opts, sessions, pages, features))
+	s.mux.HandleFunc("/get_analytics_page", analyticsVisualization(db, host, opts, sessions, pages, features))
+	s.mux.HandleFunc("/get_analytics_file", dowloadAnalyticsFile(db, host, opts, sessions, features))
+	s.mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("Hello World"))
 	})
+}
+
+// ServeHTTP makes the server an http.Handler, it can be mounted in another server or tested with httptest.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Run listens on the configured address, over TLS when it is configured, until ctx is done.
+// The in-flight requests are then drained for up to SHUTDOWN_TIMEOUT and the persistence storage is closed.
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.cfg.ListenAddr)
+	if err != nil {
+		s.db.Close()
+		return err
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve is like Run, listening on ln.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	defer s.db.Close()
+
+	server := &http.Server{Handler: s}
+	serveErr := make(chan error, 1)
+	go func() {
+		if s.cfg.TLS.Enabled() {
+			serveErr <- server.ServeTLS(ln, s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+			return
+		}
+		serveErr <- server.Serve(ln)
+	}()
+
+	select {
+	case err := <-serveErr:
+		// the server failed before being asked to stop
+		return err
+	case <-ctx.Done():
+	}
 
-	return http.ListenAndServe(":3000", nil)
+	// stop accepting requests and wait for the in-flight ones
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
 
-// init_flow initializes the Oauth Flow for the application
-func init_flow(host string) http.HandlerFunc {
+// init_flow initializes the Oauth Flow for the integration picked by the user
+func init_flow(db *persist.Persist, host string, opts ClientOptions, codec *CookieCodec, pages *pageTemplates, features []Feature) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		// the flow is started over from the picker, e.g. once the authorization has expired
+		if r.Method == http.MethodGet {
+			if err := indexPage(w, pages, db); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
 		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// parse the request form
+		// parse the request form, only the client ID of the picked integration is sent
 		r.ParseForm()
-		oauthReq := types.OAuthRequest{
-			ClientID:     strings.TrimSpace(r.FormValue("client_id")),
-			ClientSecret: strings.TrimSpace(r.FormValue("client_secret")),
-			Scope:        "analytics:read_all meeting:schedules_read",
+		integration, err := lookupIntegration(db, strings.TrimSpace(r.FormValue("integration")))
+		if err != nil {
+			// redirect to error page
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
+
+		// only the scopes of the enabled features are requested
+		scopes := requestedScopes(features, integration)
+		if len(scopes) == 0 {
+			http.Redirect(w, r, errorURL(host, fmt.Sprintf("The integration %s was not created with the scopes of any enabled feature.", integration.Label)), http.StatusSeeOther)
+			return
 		}
 
-		// create cookie for later reference
-		oauthReqStr, err := encodeToBase64(oauthReq)
+		startOAuthFlow(w, r, host, opts, codec, integration.ClientID, scopes)
+	}
+}
+
+// consent requests the scopes of a feature the user's token lacks, along with the scopes already granted.
+// The request will be like so: http://your-server.com/consent?feature=<FeatureName>
+func consent(db *persist.Persist, host string, opts ClientOptions, codec *CookieCodec, sessions *sessionStore, features []Feature) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		client, err := sessions.load(r)
 		if err != nil {
-			// redirect to error page
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
 
-		cookie := &http.Cookie{
-			Name:  "OAuthRequest",
-			Value: oauthReqStr,
+		feature, ok := featureByName(features, r.URL.Query().Get("feature"))
+		if !ok {
+			http.Redirect(w, r, errorURL(host, "Unknown or disabled feature."), http.StatusSeeOther)
+			return
 		}
-		// The server is stateless and a dabatabase is not required  because the OAuthCode is valid for small period of time and client-bound.
-		http.SetCookie(w, cookie)
 
-		// redirect to Webex, calling the auth endpoint
-		u, err := url.Parse(AUTH_URL)
+		integration, err := lookupIntegration(db, client.ClientID)
 		if err != nil {
-			// redirect to error page
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
-		q := u.Query()
-		q.Add("response_type", "code")
-		q.Add("client_id", oauthReq.ClientID)
-		q.Add("redirect_uri", fmt.Sprintf("%s/auth", host))
-		q.Add("scope", oauthReq.Scope)
-		q.Add("state", "some state")
-		u.RawQuery = q.Encode()
-		http.Redirect(w, r, u.String(), http.StatusSeeOther)
+
+		// the integration must have been created with the scopes, Webex rejects the flow otherwise
+		if len(integration.Scopes) > 0 {
+			if missing := missingScopes(integration.Scopes, feature.Scopes); len(missing) > 0 {
+				msg := fmt.Sprintf("The integration %s was not created with the scopes %s needed for %s, ask the operator to add them.",
+					integration.Label, strings.Join(missing, ", "), feature.Name)
+				http.Redirect(w, r, errorURL(host, msg), http.StatusSeeOther)
+				return
+			}
+		}
+
+		scopes := unionScopes(client.GrantedScopes(), requestedScopes(features, integration), feature.Scopes)
+		startOAuthFlow(w, r, host, opts, codec, integration.ClientID, scopes)
 	}
 }
 
+// consentURL is where the user is sent to grant the scopes of the feature.
+func consentURL(host string, feature Feature) string {
+	return fmt.Sprintf("%s/consent?feature=%s", host, url.QueryEscape(feature.Name))
+}
+
+// startOAuthFlow redirects the user to Webex to authorize the integration for the scopes.
+func startOAuthFlow(w http.ResponseWriter, r *http.Request, host string, opts ClientOptions, codec *CookieCodec, clientID string, scopes []string) {
+	// the user is identified after the flow, whatever the features
+	scopes = unionScopes(BASE_SCOPES, scopes)
+	oauthReq, err := newOAuthRequest(clientID, strings.Join(scopes, " "))
+	if err != nil {
+		// redirect to error page
+		http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+		return
+	}
+
+	// create a sealed cookie for later reference, it holds the state and PKCE verifier until the OAuth flow completes.
+	// A dabatabase is not required because the OAuthCode is valid for small period of time and client-bound.
+	cookie := &http.Cookie{
+		Name:     OAUTH_REQUEST_COOKIE,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(host, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if err := codec.setCookie(w, cookie, oauthReq, OAUTH_REQUEST_TTL); err != nil {
+		// redirect to error page
+		http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+		return
+	}
+
+	// redirect to Webex, calling the auth endpoint
+	u, err := url.Parse(opts.AuthURL())
+	if err != nil {
+		// redirect to error page
+		http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+		return
+	}
+	q := u.Query()
+	q.Add("response_type", "code")
+	q.Add("client_id", oauthReq.ClientID)
+	q.Add("redirect_uri", fmt.Sprintf("%s/auth", host))
+	q.Add("scope", oauthReq.Scope)
+	q.Add("state", oauthReq.State)
+	q.Add("code_challenge", codeChallenge(oauthReq.CodeVerifier))
+	q.Add("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
 // auth is the redirect URL that captures the OAuth code from the user's authentication.
-// The request will be like so: http://your-server.com/auth?code=<OAuthCode>
-func auth(host string) http.HandlerFunc {
+// The request will be like so: http://your-server.com/auth?code=<OAuthCode>&state=<State>
+func auth(db *persist.Persist, host string, opts ClientOptions, codec *CookieCodec, sessions *sessionStore, features []Feature) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		code := r.URL.Query().Get("code")
+		query := r.URL.Query()
+		if reason := query.Get("error"); reason != "" {
+			// the user denied access or Webex rejected the request
+			if description := query.Get("error_description"); description != "" {
+				reason = description
+			}
+			http.Redirect(w, r, errorURL(host, "Webex authorization failed: "+reason), http.StatusSeeOther)
+			return
+		}
+
+		code := query.Get("code")
 		if code == "" {
 			// redirect to error page
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, "No OAuth code provided"), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, "No OAuth code provided"), http.StatusSeeOther)
 			return
 		}
 
-		// Retrive the OAuth request from the cookie
-		cookie, err := r.Cookie("OAuthRequest")
-		if err != nil {
+		// Retrive the OAuth request from the sealed cookie
+		var oauthReq types.OAuthRequest
+		if err := codec.readCookie(r, OAUTH_REQUEST_COOKIE, &oauthReq); err != nil {
+			if errors.Is(err, http.ErrNoCookie) || errors.Is(err, ErrExpiredCookie) {
+				err = ErrOAuthRequestExpired
+			}
 			// redirect to error page
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
 
-		// Decode the OAuth code from the cookie
-		var oauthReq types.OAuthRequest
-		if err := decodeFromBase64(&oauthReq, cookie.Value); err != nil {
+		// the OAuth request is only used once
+		http.SetCookie(w, &http.Cookie{Name: OAUTH_REQUEST_COOKIE, Path: "/", MaxAge: -1})
+
+		// the redirect must come from the flow started in this browser
+		if err := verifyState(oauthReq, query.Get("state")); err != nil {
 			// redirect to error page
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
 
-		// use the code to create a WebexAPIClient
-		client, err := NewWebexAPIClient(code, oauthReq.ClientID, oauthReq.ClientSecret, fmt.Sprintf("%s/auth", host))
+		// the secret of the integration is only known to the server
+		integration, err := lookupIntegration(db, oauthReq.ClientID)
 		if err != nil {
 			// redirect to error page
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
 
-		// save the client as a cookie
-		clientStr, err := encodeToBase64(client)
+		// use the code to create a WebexAPIClient
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		client, err := NewWebexAPIClientPKCE(ctx, opts, code, oauthReq.CodeVerifier, integration.ClientID, integration.ClientSecret, fmt.Sprintf("%s/auth", host))
 		if err != nil {
 			// redirect to error page
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, errorMessage(err)), http.StatusSeeOther)
 			return
 		}
-		cookie = &http.Cookie{
-			Name:  "WebexAPIClient",
-			Value: clientStr,
+
+		// save the client in a new session, only the session ID is handed to the browser
+		if err := sessions.create(w, r, client); err != nil {
+			// redirect to error page
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
+
+		// Webex lets the user grant only part of the requested scopes
+		if granted := client.GrantedScopes(); granted != nil {
+			if missing := missingScopes(granted, strings.Fields(oauthReq.Scope)); len(missing) > 0 {
+				msg := fmt.Sprintf("Authenticated, but Webex did not grant the scopes: %s. Unavailable features: %s.",
+					strings.Join(missing, ", "), strings.Join(unavailableFeatures(features, missing), ", "))
+				http.Redirect(w, r, messageURL(host, msg), http.StatusSeeOther)
+				return
+			}
 		}
-		http.SetCookie(w, cookie)
 
 		// redirect to message page with option for API redirect
-		http.Redirect(w, r, fmt.Sprintf("%s/message?msg=%s", host, "Successfully authenticated"), http.StatusSeeOther)
+		http.Redirect(w, r, messageURL(host, "Successfully authenticated"), http.StatusSeeOther)
 	}
 }
 
 // getMeetings is the handler for the /get_meetings_page endpoint.
-func getMeetings(host string) http.HandlerFunc {
+func getMeetings(host string, opts ClientOptions, sessions *sessionStore, pages *pageTemplates, features []Feature) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// check where the cookie exists from client, if not redirect to error page
-		cookie, err := r.Cookie("WebexAPIClient")
+		// get WebexAPIClient from the session, if there is none redirect to error page
+		client, err := sessions.load(r)
 		if err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, "Complete the authentication flow."), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
+		client.Options = opts
 
-		// get WebexAPIClient from cookie
-		var client WebexAPIClient
-		if err := decodeFromBase64(&client, cookie.Value); err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+		// the token must have been granted the scopes of the feature
+		if redirect := featureURL(host, client, features, FEATURE_MEETINGS); redirect != "" {
+			http.Redirect(w, r, redirect, http.StatusSeeOther)
 			return
 		}
 
-		meetings, err := client.ListMeetings(0)
+		// the filters are provided as query parameters, the last 30 days of meetings are listed by default
+		query, err := ParseMeetingQuery(r.URL.Query())
 		if err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
+		if query.Max == 0 {
+			query.Max = MAX_PAGE_SIZE
+		}
+
+		// walk every page of meetings, the form leaves empty the bounds the user did not set so that setting
+		// only the other one, e.g. a future from, moves the whole period
+		meetings := MeetingsPageData{
+			Filters: query.FormValues(),
+			Items:   []types.MeetingSeries{},
+		}
+		for _, bound := range []string{"from", "to"} {
+			if strings.TrimSpace(r.URL.Query().Get(bound)) == "" {
+				meetings.Filters.Del(bound)
+			}
+		}
+		ctx, cancel := requestContext(r)
+		defer cancel()
+		it := client.MeetingsContext(ctx, query)
+		for it.Next() {
+			meetings.Items = append(meetings.Items, it.Meeting())
+		}
+		if err := it.Err(); err != nil {
+			http.Redirect(w, r, clientErrorURL(host, err), http.StatusSeeOther)
 			return
 		}
 
 		// render the page with data provided
-		t, _ := template.ParseFiles("./templates/get_meetings.html")
-		t.Execute(w, meetings)
+		if err := pages.render(w, "get_meetings.html", meetings); err != nil {
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
 	}
 }
 
+// MeetingsPageData is rendered by the get_meetings.html template.
+type MeetingsPageData struct {
+	// Filters are the values of the filter form.
+	Filters url.Values
+	Items   []types.MeetingSeries
+}
+
+// TemplateData is rendered by the analytics_visualization.html template.
 type TemplateData struct {
 	DataPoint string
 	MeetingID string
-	StartTime string
-	EndTime   string
-	Data      string
+	// Data is written as JSON in the script of the page.
+	Data *types.VisualData
+	// Resources is the CPU usage charted along with Data, nil when Data is the resources data point.
+	Resources *types.VisualData
 }
 
-func analyticsVisualization(db *persist.Persist, host string) http.HandlerFunc {
+func analyticsVisualization(db *persist.Persist, host string, opts ClientOptions, sessions *sessionStore, pages *pageTemplates, features []Feature) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.URL.Query().Get("id")
 		if id == "" {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, "No meeting ID provided"), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, "No meeting ID provided"), http.StatusSeeOther)
 			return
 		}
 
@@ -230,7 +508,7 @@ func analyticsVisualization(db *persist.Persist, host string) http.HandlerFunc {
 			dp = "audio_in"
 		}
 
-		qualities, errUrl := analyticsCommonfetch(r, db, id, host)
+		qualities, errUrl := analyticsCommonfetch(r, db, id, host, opts, sessions, features)
 		if errUrl != "" {
 			http.Redirect(w, r, errUrl, http.StatusSeeOther)
 			return
@@ -238,43 +516,41 @@ func analyticsVisualization(db *persist.Persist, host string) http.HandlerFunc {
 
 		chartData, err := types.GetVisualData(qualities, dp)
 		if err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
-			return
-		}
-
-		data, _ := json.Marshal(chartData)
-		t, err := template.New("analytics_visualization.html").Funcs(template.FuncMap{
-			"dpTitleName": dpTitleName,
-		}).ParseFiles("./templates/analytics_visualization.html")
-		if err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
 
 		templateData := TemplateData{
 			DataPoint: dp,
 			MeetingID: id,
-			StartTime: chartData.StartTime,
-			EndTime:   chartData.EndTime,
-			Data:      string(data),
+			Data:      chartData,
 		}
 
-		if err = t.Execute(w, templateData); err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+		// the CPU usage tells an overloaded device from a bad network
+		if dp != "resources" {
+			templateData.Resources, err = types.GetVisualData(qualities, "resources")
+			if err != nil {
+				http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+				return
+			}
+		}
+
+		if err = pages.render(w, "analytics_visualization.html", templateData); err != nil {
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
 	}
 }
 
-func dowloadAnalyticsFile(db *persist.Persist, host string) http.HandlerFunc {
+func dowloadAnalyticsFile(db *persist.Persist, host string, opts ClientOptions, sessions *sessionStore, features []Feature) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		id := r.URL.Query().Get("id")
 		if id == "" {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, "No meeting ID provided"), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, "No meeting ID provided"), http.StatusSeeOther)
 			return
 		}
 
-		qualities, errUrl := analyticsCommonfetch(r, db, id, host)
+		qualities, errUrl := analyticsCommonfetch(r, db, id, host, opts, sessions, features)
 		if errUrl != "" {
 			http.Redirect(w, r, errUrl, http.StatusSeeOther)
 			return
@@ -283,7 +559,7 @@ func dowloadAnalyticsFile(db *persist.Persist, host string) http.HandlerFunc {
 		// transform to visual data
 		visualData, err := types.GetAllVisualData(qualities)
 		if err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, "Internal Error"), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, "Internal Error"), http.StatusSeeOther)
 			return
 		}
 
@@ -295,7 +571,7 @@ func dowloadAnalyticsFile(db *persist.Persist, host string) http.HandlerFunc {
 		// pretty print the qualities as json
 		data, err := json.MarshalIndent(analytics, "", "  ")
 		if err != nil {
-			http.Redirect(w, r, fmt.Sprintf("%s/error?msg=%s", host, err.Error()), http.StatusSeeOther)
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
 			return
 		}
 
@@ -306,33 +582,84 @@ func dowloadAnalyticsFile(db *persist.Persist, host string) http.HandlerFunc {
 	}
 }
 
-func analyticsCommonfetch(r *http.Request, db *persist.Persist, id, host string) (*types.MeetingQualities, string) {
-	// check where the cookie exists from client, if not redirect to error page
-	cookie, err := r.Cookie("WebexAPIClient")
+func analyticsCommonfetch(r *http.Request, db *persist.Persist, id, host string, opts ClientOptions, sessions *sessionStore, features []Feature) (*types.MeetingQualities, string) {
+	// get WebexAPIClient from the session, if there is none redirect to error page
+	client, err := sessions.load(r)
 	if err != nil {
-		return nil, fmt.Sprintf("%s/error?msg=%s", host, "Complete the authentication flow.")
+		return nil, errorURL(host, err.Error())
 	}
+	client.Options = opts
 
-	// get WebexAPIClient from cookie
-	var client WebexAPIClient
-	if err := decodeFromBase64(&client, cookie.Value); err != nil {
-		return nil, fmt.Sprintf("%s/error?msg=%s", host, err.Error())
+	// the token must have been granted the scopes of the feature
+	if redirect := featureURL(host, client, features, FEATURE_ANALYTICS); redirect != "" {
+		return nil, redirect
 	}
 
 	// fetch analytics data
-	qualities, err := client.GetMeetingQualities(db, id, 0)
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	qualities, err := client.GetMeetingQualitiesContext(ctx, db, id, 0)
 	if err != nil {
-		return nil, fmt.Sprintf("%s/error?msg=%s", host, err.Error())
+		return nil, clientErrorURL(host, err)
+	}
+	if qualities == nil {
+		return nil, errorURL(host, types.ErrNoQualities.Error())
 	}
 
 	qualities.MeetingID = id
 	return qualities, ""
 }
 
+// featureURL is where to redirect a user who cannot use the feature, empty if the user can.
+// The user is asked to grant the scopes the token lacks, the feature must be enabled.
+func featureURL(host string, client *WebexAPIClient, features []Feature, feature Feature) string {
+	if _, ok := featureByName(features, feature.Name); !ok {
+		return errorURL(host, fmt.Sprintf("The %s feature is not enabled.", feature.Name))
+	}
+	if missing := client.MissingScopes(feature); len(missing) > 0 {
+		return consentURL(host, feature)
+	}
+	return ""
+}
+
+// requestContext derives the context of the Webex API calls made on behalf of r.
+// The calls are cancelled when the client goes away or after REQUEST_TIMEOUT.
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(r.Context(), REQUEST_TIMEOUT)
+}
+
+// errorURL is the URL of the error page displaying errorMsg.
+func errorURL(host, errorMsg string) string {
+	return fmt.Sprintf("%s/error?msg=%s", host, url.QueryEscape(errorMsg))
+}
+
+// clientErrorURL is where the user is sent when a WebexAPIClient call fails.
+// An expired authorization starts the OAuth flow over, other errors are displayed on the error page.
+func clientErrorURL(host string, err error) string {
+	if errors.Is(err, ErrRefreshTokenExpired) {
+		return fmt.Sprintf("%s/init", host)
+	}
+	return errorURL(host, errorMessage(err))
+}
+
+// messageURL is the URL of the message page displaying msg.
+func messageURL(host, msg string) string {
+	return fmt.Sprintf("%s/message?msg=%s", host, url.QueryEscape(msg))
+}
+
+// indexPage is the page where the users pick the integration to authorize.
+func indexPage(w io.Writer, pages *pageTemplates, db *persist.Persist) error {
+	integrations, err := integrationOptions(db)
+	if err != nil {
+		return err
+	}
+
+	return pages.render(w, "index.html", IndexPageData{Integrations: integrations})
+}
+
 // errorPage is the error page that is displayed when an error occurs.
-func errorPage(w io.Writer, errorMsg string) error {
-	tmpl, _ := template.ParseFiles("./templates/generic_page.html")
-	return tmpl.Execute(w, types.GenericPage{
+func errorPage(w io.Writer, pages *pageTemplates, errorMsg string) error {
+	return pages.render(w, "generic_page.html", types.GenericPage{
 		Heading:          "Error",
 		Message:          errorMsg,
 		ShowHomeRedirect: true,
@@ -341,9 +668,8 @@ func errorPage(w io.Writer, errorMsg string) error {
 
 // messagePage is the page that displays the messages also allowing for redirect to the
 // apiCalls page
-func messagePage(w io.Writer, message string, apiRedirect bool) error {
-	tmpl, _ := template.ParseFiles("./templates/generic_page.html")
-	return tmpl.Execute(w, types.GenericPage{
+func messagePage(w io.Writer, pages *pageTemplates, message string, apiRedirect bool) error {
+	return pages.render(w, "generic_page.html", types.GenericPage{
 		Heading:          "Message",
 		Message:          message,
 		ShowAPIRedirect:  apiRedirect,
@@ -351,23 +677,6 @@ func messagePage(w io.Writer, message string, apiRedirect bool) error {
 	})
 }
 
-// encodeToBase64 encodes a non-pointer type to a base64 string
-func encodeToBase64(v interface{}) (string, error) {
-	var buf bytes.Buffer
-	encoder := base64.NewEncoder(base64.StdEncoding, &buf)
-	err := json.NewEncoder(encoder).Encode(v)
-	if err != nil {
-		return "", err
-	}
-	encoder.Close()
-	return buf.String(), nil
-}
-
-// decodeFromBase64 decodes a base64 string to a non-pointer type
-func decodeFromBase64(v interface{}, enc string) error {
-	return json.NewDecoder(base64.NewDecoder(base64.StdEncoding, strings.NewReader(enc))).Decode(v)
-}
-
 // getWebexAPIClientCookie parses the cookies string and retrives the "cookieName" key cookie value
 func getCookieValue(cookies, cookieName string) (string, error) {
 	// Sample cookies string: "username=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;"
@@ -396,6 +705,8 @@ func dpTitleName(dp string) string {
 		return "Share In"
 	case "share_out":
 		return "Share Out"
+	case "resources":
+		return "Resources"
 	default:
 		return "Unknown"
 	}
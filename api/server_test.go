@@ -1,42 +1,23 @@
 package api
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
 	"errors"
-	"reflect"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	"Webex.API.Integration.And.Visualization/types"
+	"Webex.API.Integration.And.Visualization/config"
+	"Webex.API.Integration.And.Visualization/persist"
 )
 
-func TestEncodeDecodeFromBase64(t *testing.T) {
-	data := WebexAPIClient{
-		ClientID:     "clientID",
-		ClientSecret: "clientSecret",
-		RedirectURI:  "redirectURI",
-		Auth: types.AuthResponse{
-			AccessToken:  "accessToken",
-			RefreshToken: "refreshToken",
-			ExpiresIn:    100,
-		},
-	}
-
-	// encode to base64
-	encStr, err := encodeToBase64(data)
-	if err != nil {
-		t.Errorf("encodeToBase64 failed: %v", err)
-	}
-
-	// decode from base64
-	var decData WebexAPIClient
-	if err := decodeFromBase64(&decData, encStr); err != nil {
-		t.Errorf("decodeFromBase64 failed: %v", err)
-	}
-
-	if !reflect.DeepEqual(data, decData) {
-		t.Errorf("decodeFromBase64 failed: %v", err)
-	}
-}
-
 func TestGetWebexAPIClientCookie(t *testing.T) {
 	sample := "username=; expires=Thu, 01 Jan 1970 00:00:00 UTC; path=/;"
 	tests := []struct {
@@ -86,3 +67,104 @@ func TestGetWebexAPIClientCookie(t *testing.T) {
 		})
 	}
 }
+
+// newTestServer creates a Server from a configuration, with a fresh database.
+func newTestServer(t *testing.T) (*Server, *persist.Persist) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "webex.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	p, err := persist.NewPersist(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := config.Default()
+	cfg.Host = "http://localhost:3000"
+	cfg.ListenAddr = "127.0.0.1:0"
+	cfg.Integrations = []config.Integration{{ClientID: testClientID, ClientSecret: testClientSecret, Label: "Configured integration"}}
+	cfg.Cookies.Keys = []string{"test:" + base64.StdEncoding.EncodeToString(make([]byte, 32))}
+
+	s, err := NewServer(p, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, p
+}
+
+func TestServerHandler(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	// the server is a plain http.Handler, nothing is registered on the default ServeMux
+	for path, want := range map[string]string{"/hello": "Hello World", "/": "Configured integration"} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("GET %s: want %q, got %d: %s", path, want, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	http.DefaultServeMux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("want nothing on the default ServeMux, got %d", rec.Code)
+	}
+}
+
+func TestServerGracefulShutdown(t *testing.T) {
+	s, p := newTestServer(t)
+
+	// a slow request is in flight when the server is stopped
+	started, release := make(chan struct{}), make(chan struct{})
+	s.mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ctx, ln) }()
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		body <- string(b)
+	}()
+
+	<-started
+	stop()
+	select {
+	case err := <-served:
+		t.Fatalf("want the in-flight request drained first, Serve returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if got := <-body; got != "done" {
+		t.Errorf("want the in-flight request completed, got %q", got)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("want a clean shutdown, got %v", err)
+	}
+
+	// the persistence storage is closed
+	if _, err := p.ListIntegrations(); err == nil {
+		t.Errorf("want the database closed")
+	}
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"Webex.API.Integration.And.Visualization/persist"
+)
+
+const (
+	// SESSION_COOKIE is the cookie holding the opaque session ID.
+	SESSION_COOKIE = "webex_session"
+	// DEFAULT_SESSION_TTL is how long a session lasts after the user logged in.
+	DEFAULT_SESSION_TTL = 7 * 24 * time.Hour
+)
+
+// errNoSession is returned when the request carries no valid session.
+var errNoSession = errors.New("Complete the authentication flow.")
+
+// sessionStore keeps the browser sessions of the authenticated users server-side, a session refers to the
+// credentials of its user. The browser only holds the opaque session ID sealed by the codec, so the client secret
+// and the tokens never leave the server.
+type sessionStore struct {
+	db          *persist.Persist
+	credentials *credentialStore
+	ttl         time.Duration
+	codec       *CookieCodec
+	// secure is set when the server is reached over HTTPS, the cookie is then only sent over HTTPS.
+	secure bool
+}
+
+func newSessionStore(db *persist.Persist, host string, ttl time.Duration, codec *CookieCodec) *sessionStore {
+	if ttl == 0 {
+		ttl = DEFAULT_SESSION_TTL
+	}
+
+	return &sessionStore{
+		db:          db,
+		credentials: &credentialStore{db},
+		ttl:         ttl,
+		codec:       codec,
+		secure:      strings.HasPrefix(host, "https://"),
+	}
+}
+
+// create saves the client as the credentials of its user, opens a new session for them and sets the session cookie.
+// A session the request already carries is deleted, so a session ID is never reused across logins.
+func (s *sessionStore) create(w http.ResponseWriter, r *http.Request, client *WebexAPIClient) error {
+	var previous string
+	if err := s.codec.readCookie(r, SESSION_COOKIE, &previous); err == nil {
+		if err := s.db.DeleteSession(previous); err != nil {
+			log.Printf("error on DeleteSession(): %s\n", err.Error())
+		}
+	}
+	if err := s.db.DeleteExpiredSessions(); err != nil {
+		log.Printf("error on DeleteExpiredSessions(): %s\n", err.Error())
+	}
+
+	// the new authorization replaces the one of the user's other sessions and access tokens
+	if err := s.credentials.save(client); err != nil {
+		return err
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return err
+	}
+	if err := s.db.SaveSession(id, client.ClientID, client.PersonID, time.Now().Add(s.ttl)); err != nil {
+		return err
+	}
+
+	return s.codec.setCookie(w, &http.Cookie{
+		Name:     SESSION_COOKIE,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	}, id, s.ttl)
+}
+
+// load retrieves the client of the user of the request's session.
+// Token refreshes made by the client are saved back to the user's credentials.
+func (s *sessionStore) load(r *http.Request) (*WebexAPIClient, error) {
+	_, clientID, personID, err := s.retrieve(r)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := s.credentials.load(clientID, personID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, errNoSession
+	}
+	return client, nil
+}
+
+// id is the ID of the request's session.
+func (s *sessionStore) id(r *http.Request) (string, error) {
+	id, _, _, err := s.retrieve(r)
+	return id, err
+}
+
+// retrieve reads the session ID of the request and the integration and user of the session, which must not have expired.
+func (s *sessionStore) retrieve(r *http.Request) (string, string, string, error) {
+	var id string
+	if err := s.codec.readCookie(r, SESSION_COOKIE, &id); err != nil {
+		return "", "", "", errNoSession
+	}
+
+	clientID, personID, err := s.db.RetrieveSession(id)
+	if err != nil {
+		return "", "", "", err
+	}
+	if clientID == "" {
+		return "", "", "", errNoSession
+	}
+	return id, clientID, personID, nil
+}
+
+// newSessionID generates a random, URL and cookie safe session ID.
+func newSessionID() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"Webex.API.Integration.And.Visualization/webextest"
+)
+
+// sessionClient loads the client of the browser's session.
+func (a *testApp) sessionClient(t *testing.T) *WebexAPIClient {
+	t.Helper()
+
+	u, _ := url.Parse(a.server.URL)
+	req := httptest.NewRequest(http.MethodGet, a.server.URL, nil)
+	for _, cookie := range a.browser.Jar.Cookies(u) {
+		req.AddCookie(cookie)
+	}
+
+	client, err := a.sessions.load(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestSessionCookie(t *testing.T) {
+	app := newTestApp(t)
+	client := app.client(t)
+
+	w := httptest.NewRecorder()
+	if err := app.sessions.create(w, httptest.NewRequest(http.MethodGet, "/auth", nil), client); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("want only the session cookie, got %v", cookies)
+	}
+	cookie := cookies[0]
+	if cookie.Name != SESSION_COOKIE || !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode || cookie.Path != "/" {
+		t.Errorf("unexpected session cookie attributes: %s", cookie)
+	}
+	for _, secret := range []string{testClientSecret, client.Auth.AccessToken, client.Auth.RefreshToken} {
+		if strings.Contains(cookie.String(), secret) {
+			t.Errorf("session cookie leaks %q", secret)
+		}
+	}
+
+	secure := newSessionStore(app.db, "https://example.com", 0, app.sessions.codec)
+	w = httptest.NewRecorder()
+	if err := secure.create(w, httptest.NewRequest(http.MethodGet, "/auth", nil), client); err != nil {
+		t.Fatal(err)
+	}
+	if cookie := w.Result().Cookies()[0]; !cookie.Secure {
+		t.Errorf("want a Secure session cookie over HTTPS, got %s", cookie)
+	}
+}
+
+func TestSessionLoad(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+
+	// the secret is looked up from the integration, it is not stored with the credentials
+	client := app.sessionClient(t)
+	if client.ClientSecret != testClientSecret || client.PersonID != webextest.DEFAULT_PERSON_ID {
+		t.Errorf("want the client of the user with the integration's secret, got %q of %q", client.ClientSecret, client.PersonID)
+	}
+	data, err := app.db.RetrieveCredentials(testClientID, webextest.DEFAULT_PERSON_ID)
+	if err != nil || data == "" || strings.Contains(data, testClientSecret) {
+		t.Errorf("want the credentials stored without the client secret, got %q, %v", data, err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := app.sessions.load(req); err != errNoSession {
+		t.Errorf("want errNoSession without a cookie, got %v", err)
+	}
+
+	req.AddCookie(&http.Cookie{Name: SESSION_COOKIE, Value: "unknown"})
+	if _, err := app.sessions.load(req); err != errNoSession {
+		t.Errorf("want errNoSession for an unknown session, got %v", err)
+	}
+}
+
+func TestSessionLoginReplacesSession(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+
+	before := app.sessionID(t)
+	app.login(t)
+
+	if after := app.sessionID(t); after == before {
+		t.Error("want a new session ID")
+	}
+	if clientID, _, err := app.db.RetrieveSession(before); err != nil || clientID != "" {
+		t.Errorf("want the previous session deleted, got %q, %v", clientID, err)
+	}
+}
+
+func TestSessionOfRemovedIntegration(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+
+	// the credentials cannot be used without the secret of the integration
+	if err := app.db.DeleteIntegration(testClientID); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := app.get(t, "/get_meetings_page")
+	if resp.Request.URL.Path != "/error" || !strings.Contains(body, "not available") {
+		t.Errorf("want the error page, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func TestRefreshedTokenIsSavedInSession(t *testing.T) {
+	app := newTestApp(t)
+	app.webex.AddMeetings(1)
+	app.login(t)
+
+	accessToken := app.sessionClient(t).Auth.AccessToken
+	app.webex.ExpireAccessTokens()
+
+	resp, body := app.get(t, "/get_meetings_page")
+	if resp.StatusCode != http.StatusOK || resp.Request.URL.Path != "/get_meetings_page" {
+		t.Fatalf("meetings page ended at %s with: %s", resp.Request.URL, body)
+	}
+
+	if got := app.sessionClient(t).Auth.AccessToken; got == accessToken {
+		t.Error("refreshed access token was not saved in the session")
+	}
+
+	// the next request uses the saved token, without refreshing again
+	refreshes := app.webex.Calls("/v1/access_token")
+	app.get(t, "/get_meetings_page")
+	if got := app.webex.Calls("/v1/access_token"); got != refreshes {
+		t.Errorf("want no more refreshes, got %d", got-refreshes)
+	}
+}
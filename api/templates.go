@@ -0,0 +1,65 @@
+package api
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"io/fs"
+	"os"
+
+	"Webex.API.Integration.And.Visualization/templates"
+)
+
+// templateFuncs are the functions available to every template.
+var templateFuncs = template.FuncMap{
+	"dpTitleName": dpTitleName,
+}
+
+// pageTemplates renders the HTML templates of the server.
+// They are html/template templates, the values are escaped for the context they are written in.
+// They are embedded in the binary and parsed once, unless they are read from a directory in dev mode.
+type pageTemplates struct {
+	// dir is the directory the templates are re-parsed from on every render, empty for the embedded templates.
+	dir    string
+	parsed *template.Template
+}
+
+// newPageTemplates parses the embedded templates, or in dev mode the templates of dir, which are then
+// hot-reloaded: an edited template is picked up by the next render without restarting the server.
+func newPageTemplates(dir string) (*pageTemplates, error) {
+	pages := &pageTemplates{dir: dir}
+
+	// parse once to report broken templates on startup, even in dev mode
+	parsed, err := pages.parse()
+	if err != nil {
+		return nil, err
+	}
+	pages.parsed = parsed
+	return pages, nil
+}
+
+func (p *pageTemplates) parse() (*template.Template, error) {
+	var files fs.FS = templates.FS
+	if p.dir != "" {
+		files = os.DirFS(p.dir)
+	}
+	return template.New("").Funcs(templateFuncs).ParseFS(files, "*.html")
+}
+
+// render executes the template name with data, nothing is written to w if it fails.
+func (p *pageTemplates) render(w io.Writer, name string, data interface{}) error {
+	parsed := p.parsed
+	if p.dir != "" {
+		var err error
+		if parsed, err = p.parse(); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := parsed.ExecuteTemplate(&buf, name, data); err != nil {
+		return err
+	}
+	_, err := buf.WriteTo(w)
+	return err
+}
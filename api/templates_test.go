@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+func TestEmbeddedTemplates(t *testing.T) {
+	pages, err := newPageTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"index.html", "generic_page.html", "get_meetings.html", "analytics_visualization.html", "api_calls.html"} {
+		if pages.parsed.Lookup(name) == nil {
+			t.Errorf("want %s embedded", name)
+		}
+	}
+
+	// the shared functions are available to every template
+	var buf bytes.Buffer
+	if err := pages.render(&buf, "analytics_visualization.html", TemplateData{DataPoint: "video_in", Data: &types.VisualData{}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Data for Video In") {
+		t.Errorf("want dpTitleName applied: %s", buf.String())
+	}
+}
+
+func TestDevTemplatesHotReload(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "page.html")
+	if err := os.WriteFile(page, []byte(`before {{ dpTitleName . }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pages, err := newPageTemplates(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	render := func() string {
+		var buf bytes.Buffer
+		if err := pages.render(&buf, "page.html", "audio_in"); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	if got := render(); got != "before Audio In" {
+		t.Errorf("unexpected render %q", got)
+	}
+
+	// an edited template is picked up without restarting
+	if err := os.WriteFile(page, []byte(`after {{ dpTitleName . }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(); got != "after Audio In" {
+		t.Errorf("want the edited template, got %q", got)
+	}
+}
+
+func TestBrokenTemplatesFailOnStartup(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "page.html"), []byte(`{{ if }}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newPageTemplates(dir); err == nil {
+		t.Error("want an error for a broken template")
+	}
+}
+
+func TestRenderErrorWritesNothing(t *testing.T) {
+	pages, err := newPageTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := pages.render(&buf, "missing.html", nil); err == nil {
+		t.Error("want an error for a missing template")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("want nothing written, got %q", buf.String())
+	}
+}
+
+func TestMetricsOfDataPoint(t *testing.T) {
+	pages, err := newPageTemplates("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the resolution and frame rate are only offered for the video and share data points
+	for _, dp := range types.DATA_POINTS {
+		var buf bytes.Buffer
+		if err := pages.render(&buf, "analytics_visualization.html", TemplateData{DataPoint: dp, Data: &types.VisualData{}}); err != nil {
+			t.Fatal(err)
+		}
+		video := strings.HasPrefix(dp, "video_") || strings.HasPrefix(dp, "share_")
+		for _, metric := range []string{`value="resolution_height"`, `value="frame_rate"`} {
+			if got := strings.Contains(buf.String(), metric); got != video {
+				t.Errorf("%s: want %s offered %v, got %v", dp, metric, video, got)
+			}
+		}
+	}
+}
+
+func TestHostileValuesAreEscaped(t *testing.T) {
+	const hostile = `</script><script>alert("x")</script><img src=x onerror=alert(1)>`
+
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	meeting.Title = hostile
+	meeting.Agenda = hostile
+	app.webex.SetMeeting(meeting)
+	app.login(t)
+
+	// the meeting title and agenda are HTML text
+	_, body := app.get(t, "/get_meetings_page")
+	if strings.Contains(body, "<script>alert") || strings.Contains(body, "<img src=x") {
+		t.Errorf("the meetings page renders the hostile title unescaped: %s", body)
+	}
+	if !strings.Contains(body, "&lt;/script&gt;&lt;script&gt;alert(&#34;x&#34;)") {
+		t.Errorf("want the title escaped: %s", body)
+	}
+
+	// the message of the error page is HTML text
+	_, body = app.get(t, "/error?msg="+url.QueryEscape(hostile))
+	if strings.Contains(body, "<script>alert") || !strings.Contains(body, "&lt;script&gt;") {
+		t.Errorf("the error page renders the message unescaped: %s", body)
+	}
+
+	// the meeting ID is written in the chart data, in URLs and in HTML text
+	hostileID := `x"></a><script>alert(1)</script>'`
+	app.webex.SetQualities(hostileID, app.webex.Qualities(meeting.ID))
+	resp, body := app.get(t, "/get_analytics_page?id="+url.QueryEscape(hostileID)+"&dp=video_in")
+	if resp.Request.URL.Path != "/get_analytics_page" {
+		t.Fatalf("want the analytics page, ended at %s with: %s", resp.Request.URL, body)
+	}
+	if strings.Contains(body, "<script>alert") {
+		t.Errorf("the analytics page renders the meeting ID unescaped: %s", body)
+	}
+	if !strings.Contains(body, `href="/get_analytics_page?id=x%22%3e%3c%2fa%3e%3cscript%3ealert%281%29%3c%2fscript%3e%27&dp=audio_in"`) {
+		t.Errorf("want the meeting ID query escaped in the links: %s", body)
+	}
+
+	// the chart data is still a JS object, not a string
+	if !strings.Contains(body, `var analytics = {"meeting_id":"x\"`+"\\u003e\\u003c/a\\u003e") {
+		t.Errorf("want the chart data as an escaped JS object: %s", body)
+	}
+}
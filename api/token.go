@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// DEFAULT_REFRESH_LEEWAY is how long before its expiry the access token is refreshed.
+const DEFAULT_REFRESH_LEEWAY = 5 * time.Minute
+
+// ErrRefreshTokenExpired is returned when the refresh token can no longer be used,
+// the user has to go through the OAuth flow again.
+var ErrRefreshTokenExpired = errors.New("the Webex authorization has expired, authorize the integration again")
+
+// AccessTokenExpiresAt is when the access token expires, the zero time when it is unknown.
+func (c *WebexAPIClient) AccessTokenExpiresAt() time.Time {
+	if c.IssuedAt.IsZero() || c.Auth.ExpiresIn == 0 {
+		return time.Time{}
+	}
+	return c.IssuedAt.Add(time.Duration(c.Auth.ExpiresIn) * time.Second)
+}
+
+// RefreshTokenExpiresAt is when the refresh token expires, the zero time when it is unknown.
+func (c *WebexAPIClient) RefreshTokenExpiresAt() time.Time {
+	issuedAt := c.refreshIssuedAt()
+	if issuedAt.IsZero() || c.Auth.RefreshTokenExpiresIn == 0 {
+		return time.Time{}
+	}
+	return issuedAt.Add(time.Duration(c.Auth.RefreshTokenExpiresIn) * time.Second)
+}
+
+// refreshIssuedAt is when the refresh token was issued, clients saved before it was recorded count it from IssuedAt.
+func (c *WebexAPIClient) refreshIssuedAt() time.Time {
+	if c.RefreshIssuedAt.IsZero() {
+		return c.IssuedAt
+	}
+	return c.RefreshIssuedAt
+}
+
+// ensureToken refreshes the access token ahead of its expiry, so API calls are not made with a token about to expire.
+// Tokens whose expiry is unknown are only refreshed once Webex rejects them.
+func (c *WebexAPIClient) ensureToken(ctx context.Context) error {
+	now := time.Now()
+	if expiresAt := c.RefreshTokenExpiresAt(); !expiresAt.IsZero() && !now.Before(expiresAt) {
+		return ErrRefreshTokenExpired
+	}
+
+	leeway := c.Options.RefreshLeeway
+	if leeway == 0 {
+		leeway = DEFAULT_REFRESH_LEEWAY
+	}
+	if expiresAt := c.AccessTokenExpiresAt(); !expiresAt.IsZero() && now.Add(leeway).After(expiresAt) {
+		return c.refreshToken(ctx)
+	}
+
+	return nil
+}
+
+// REFRESH_REUSE is how long the outcome of a refresh is handed to callers still holding the old refresh token.
+const REFRESH_REUSE = time.Minute
+
+// refreshes serializes the token refreshes of the server, so that concurrent handlers holding the same
+// refresh token do not both use it.
+var refreshes = &refreshGroup{calls: map[string]*refreshCall{}}
+
+// refreshGroup deduplicates refreshes by refresh token.
+type refreshGroup struct {
+	mu    sync.Mutex
+	calls map[string]*refreshCall
+}
+
+// refreshCall is an in-flight or recently completed refresh.
+type refreshCall struct {
+	done     chan struct{}
+	auth     types.AuthResponse
+	issuedAt time.Time
+	err      error
+}
+
+// do runs refresh for the refresh token, unless a refresh for it is in flight or recently succeeded,
+// in which case its outcome is returned.
+func (g *refreshGroup) do(ctx context.Context, refreshToken string, refresh func() (types.AuthResponse, error)) (types.AuthResponse, time.Time, error) {
+	g.mu.Lock()
+	for token, call := range g.calls {
+		if isDone(call.done) && time.Since(call.issuedAt) > REFRESH_REUSE {
+			delete(g.calls, token)
+		}
+	}
+
+	call, ok := g.calls[refreshToken]
+	if !ok {
+		call = &refreshCall{done: make(chan struct{})}
+		g.calls[refreshToken] = call
+		g.mu.Unlock()
+
+		call.auth, call.err = refresh()
+		call.issuedAt = time.Now()
+
+		g.mu.Lock()
+		if call.err != nil {
+			// a failed refresh is not reused, the next caller tries again
+			delete(g.calls, refreshToken)
+		}
+		g.mu.Unlock()
+		close(call.done)
+
+		return call.auth, call.issuedAt, call.err
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return types.AuthResponse{}, time.Time{}, ctx.Err()
+	case <-call.done:
+		return call.auth, call.issuedAt, call.err
+	}
+}
+
+func isDone(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProactiveTokenRefresh(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	client := app.client(t)
+
+	// the access token expires within the refresh leeway
+	client.IssuedAt = time.Now().Add(-time.Duration(client.Auth.ExpiresIn)*time.Second + time.Minute)
+	accessToken := client.Auth.AccessToken
+	refreshes := app.webex.Calls("/v1/access_token")
+
+	if _, err := client.GetMeetingQualities(app.db, meeting.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := app.webex.Calls("/v1/access_token"); got != refreshes+1 {
+		t.Errorf("want 1 token refresh, got %d", got-refreshes)
+	}
+	if client.Auth.AccessToken == accessToken {
+		t.Error("access token was not replaced")
+	}
+	if time.Until(client.AccessTokenExpiresAt()) < time.Hour {
+		t.Errorf("want the new access token to expire later, expires at %s", client.AccessTokenExpiresAt())
+	}
+}
+
+func TestRefreshKeepingTheRefreshToken(t *testing.T) {
+	app := newTestApp(t)
+	app.webex.AddMeetings(1)
+	client := app.client(t)
+	app.webex.KeepRefreshTokens()
+
+	// the access token expires within the refresh leeway, the refresh token was issued with it
+	client.IssuedAt = time.Now().Add(-time.Duration(client.Auth.ExpiresIn)*time.Second + time.Minute)
+	client.RefreshIssuedAt = client.IssuedAt
+	refreshToken, refreshExpiresAt := client.Auth.RefreshToken, client.RefreshTokenExpiresAt()
+	refreshes := app.webex.Calls("/v1/access_token")
+
+	// the new access token is fresh, so it is not refreshed again on the next calls
+	for i := 0; i < 3; i++ {
+		if _, err := client.ListMeetings(DefaultMeetingQuery()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := app.webex.Calls("/v1/access_token"); got != refreshes+1 {
+		t.Errorf("want 1 token refresh, got %d", got-refreshes)
+	}
+	if time.Until(client.AccessTokenExpiresAt()) < time.Hour {
+		t.Errorf("want the new access token to expire later, expires at %s", client.AccessTokenExpiresAt())
+	}
+
+	// the kept refresh token still expires when it was going to
+	if client.Auth.RefreshToken != refreshToken || !client.RefreshTokenExpiresAt().Equal(refreshExpiresAt) {
+		t.Errorf("want refresh token %s expiring at %s, got %s expiring at %s", refreshToken, refreshExpiresAt, client.Auth.RefreshToken, client.RefreshTokenExpiresAt())
+	}
+}
+
+func TestExpiredRefreshToken(t *testing.T) {
+	app := newTestApp(t)
+	client := app.client(t)
+
+	client.RefreshIssuedAt = time.Now().Add(-time.Duration(client.Auth.RefreshTokenExpiresIn+1) * time.Second)
+	refreshes := app.webex.Calls("/v1/access_token")
+
+	if _, err := client.ListMeetings(DefaultMeetingQuery()); !errors.Is(err, ErrRefreshTokenExpired) {
+		t.Fatalf("want ErrRefreshTokenExpired, got %v", err)
+	}
+	if got := app.webex.Calls("/v1/access_token"); got != refreshes {
+		t.Errorf("want no refresh with an expired refresh token, got %d", got-refreshes)
+	}
+}
+
+func TestRejectedRefreshTokenRestartsOAuthFlow(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+
+	app.webex.ExpireAccessTokens()
+	app.webex.ExpireRefreshTokens()
+
+	resp, body := app.get(t, "/get_meetings_page")
+	if resp.Request.URL.Path != "/init" {
+		t.Fatalf("want redirect to /init, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func TestConcurrentRefreshesAreSerialized(t *testing.T) {
+	app := newTestApp(t)
+	app.webex.AddMeetings(1)
+	client := app.client(t)
+
+	app.webex.ExpireAccessTokens()
+	refreshes := app.webex.Calls("/v1/access_token")
+
+	// every handler decodes its own copy of the client holding the same refresh token
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(c WebexAPIClient) {
+			defer wg.Done()
+			_, err := c.ListMeetings(DefaultMeetingQuery())
+			errs <- err
+		}(*client)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := app.webex.Calls("/v1/access_token"); got != refreshes+1 {
+		t.Errorf("want 1 token refresh, got %d", got-refreshes)
+	}
+}
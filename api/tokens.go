@@ -0,0 +1,200 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"Webex.API.Integration.And.Visualization/persist"
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+const (
+	// ACCESS_TOKEN_PREFIX starts every personal access token, so leaked tokens are easy to recognize.
+	ACCESS_TOKEN_PREFIX = "wxpat_"
+	// ACCESS_TOKEN_TTL is how long a personal access token authenticates, as long as a Webex refresh token lasts.
+	ACCESS_TOKEN_TTL = 90 * 24 * time.Hour
+)
+
+// errInvalidToken is returned when the bearer token of a request is unknown, expired or revoked.
+var errInvalidToken = errors.New("The access token is invalid, has expired or has been revoked.")
+
+// tokenStore keeps the personal access tokens machine clients authenticate with on the JSON API.
+// A token is owned by the Webex user who created it through an integration and authenticates with the user's
+// credentials, so it keeps working once the browser session is gone, until it expires. Only its hash is stored.
+type tokenStore struct {
+	db          *persist.Persist
+	credentials *credentialStore
+	clock       func() time.Time
+}
+
+func newTokenStore(db *persist.Persist) *tokenStore {
+	return &tokenStore{db: db, credentials: &credentialStore{db}, clock: time.Now}
+}
+
+// create issues a token named name for the user of the client, authenticating with the user's credentials.
+// The returned token is the only time it is available in clear.
+func (s *tokenStore) create(name string, client *WebexAPIClient) (string, *types.AccessToken, error) {
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+
+	token := ACCESS_TOKEN_PREFIX + base64.RawURLEncoding.EncodeToString(secret)
+	now := s.clock()
+	accessToken := &types.AccessToken{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ACCESS_TOKEN_TTL),
+	}
+	if err := s.db.SaveAccessToken(*accessToken, client.ClientID, client.PersonID, hashToken(token)); err != nil {
+		return "", nil, err
+	}
+	return token, accessToken, nil
+}
+
+// authenticate retrieves the client of the user of the bearer token of the request and records its use.
+// Token refreshes made by the client are saved back to the user's credentials.
+func (s *tokenStore) authenticate(r *http.Request) (*WebexAPIClient, error) {
+	token, ok := bearerToken(r)
+	if !ok || !strings.HasPrefix(token, ACCESS_TOKEN_PREFIX) {
+		return nil, errInvalidToken
+	}
+
+	accessToken, clientID, personID, err := s.db.RetrieveAccessToken(hashToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if accessToken == nil || !s.clock().Before(accessToken.ExpiresAt) {
+		return nil, errInvalidToken
+	}
+
+	if err := s.db.TouchAccessToken(accessToken.ID, s.clock()); err != nil {
+		log.Printf("error on TouchAccessToken(): %s\n", err.Error())
+	}
+
+	client, err := s.credentials.load(clientID, personID)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, errInvalidToken
+	}
+	return client, nil
+}
+
+// bearerToken is the token of the "Authorization: Bearer <token>" header of the request.
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// hashToken is what is stored of a token, the tokens are random so a plain SHA-256 is enough.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MAX_TOKEN_NAME_LENGTH bounds the name given to an access token.
+const MAX_TOKEN_NAME_LENGTH = 100
+
+// SettingsPageData is rendered by the settings.html template.
+type SettingsPageData struct {
+	Tokens []types.AccessToken
+	// NewToken is the token just created, shown once.
+	NewToken      string
+	NewTokenName  string
+	MaxNameLength int
+	// Now tells the expired tokens apart.
+	Now time.Time
+}
+
+// settings is the handler for the /settings page, where the user lists and creates access tokens.
+func settings(host string, sessions *sessionStore, tokens *tokenStore, pages *pageTemplates) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// the tokens are owned by the user of the session, if there is none redirect to error page
+		client, err := sessions.load(r)
+		if err != nil {
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
+
+		data := SettingsPageData{MaxNameLength: MAX_TOKEN_NAME_LENGTH, Now: tokens.clock()}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPost:
+			// create a token acting with the session's Webex authorization
+			name := strings.TrimSpace(r.PostFormValue("name"))
+			if name == "" || len(name) > MAX_TOKEN_NAME_LENGTH {
+				http.Redirect(w, r, errorURL(host, "Name the access token, in at most 100 characters."), http.StatusSeeOther)
+				return
+			}
+			if data.NewToken, _, err = tokens.create(name, client); err != nil {
+				log.Printf("error on create(): %s\n", err.Error())
+				http.Redirect(w, r, errorURL(host, "The access token could not be created."), http.StatusSeeOther)
+				return
+			}
+			data.NewTokenName = name
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if data.Tokens, err = tokens.db.ListAccessTokens(client.ClientID, client.PersonID); err != nil {
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
+
+		// the page shows a new token, it must not be cached
+		w.Header().Set("Cache-Control", "no-store")
+		if err := pages.render(w, "settings.html", data); err != nil {
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
+	}
+}
+
+// revokeToken is the handler for /settings/revoke, the token is deleted at once.
+func revokeToken(host string, sessions *sessionStore, tokens *tokenStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		client, err := sessions.load(r)
+		if err != nil {
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
+
+		// only the tokens of the session's user can be revoked
+		found, err := tokens.db.DeleteAccessToken(client.ClientID, client.PersonID, r.PostFormValue("id"))
+		if err != nil {
+			http.Redirect(w, r, errorURL(host, err.Error()), http.StatusSeeOther)
+			return
+		}
+		if !found {
+			http.Redirect(w, r, errorURL(host, "The access token does not exist."), http.StatusSeeOther)
+			return
+		}
+
+		http.Redirect(w, r, host+"/settings", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"Webex.API.Integration.And.Visualization/webextest"
+)
+
+var newTokenPattern = regexp.MustCompile(`<pre id="new-token">(` + ACCESS_TOKEN_PREFIX + `[A-Za-z0-9_-]+)</pre>`)
+
+// createToken creates an access token on the settings page of the browser's session.
+func (a *testApp) createToken(t *testing.T, name string) string {
+	t.Helper()
+
+	resp, err := a.browser.PostForm(a.server.URL+"/settings", url.Values{"name": {name}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := readBody(t, resp)
+
+	match := newTokenPattern.FindStringSubmatch(body)
+	if resp.StatusCode != http.StatusOK || match == nil {
+		t.Fatalf("want the new token shown, ended at %s with: %s", resp.Request.URL, body)
+	}
+	return match[1]
+}
+
+// bearerGet requests path with the access token, without any cookie.
+func (a *testApp) bearerGet(t *testing.T, path, token string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, a.server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, readBody(t, resp)
+}
+
+func TestAccessToken(t *testing.T) {
+	app := newTestApp(t)
+	meeting := app.webex.AddMeetings(1)[0]
+	app.login(t)
+
+	token := app.createToken(t, "CI pipeline")
+
+	// the token is only stored hashed and shown once
+	stored, clientID, personID, err := app.db.RetrieveAccessToken(hashToken(token))
+	if err != nil || stored == nil || stored.Name != "CI pipeline" {
+		t.Fatalf("want the token stored by its hash, got %+v, %v", stored, err)
+	}
+	if clientID != testClientID || personID != webextest.DEFAULT_PERSON_ID {
+		t.Errorf("want the token owned by the Webex user, got %s of %s", personID, clientID)
+	}
+	if ttl := stored.ExpiresAt.Sub(stored.CreatedAt); ttl != ACCESS_TOKEN_TTL {
+		t.Errorf("want the token to expire after %s, got %s", ACCESS_TOKEN_TTL, ttl)
+	}
+	if stored, _, _, _ := app.db.RetrieveAccessToken(token); stored != nil {
+		t.Errorf("the token is stored in clear")
+	}
+	_, body := app.get(t, "/settings")
+	if strings.Contains(body, token) || !strings.Contains(body, "CI pipeline") || !strings.Contains(body, "Never") {
+		t.Errorf("want the token listed without its value, got: %s", body)
+	}
+
+	// the token authenticates on the data endpoints
+	for _, path := range []string{"/api/v1/meetings", "/api/v1/meetings/" + meeting.ID + "/qualities", "/api/v1/meetings/" + meeting.ID + "/visual"} {
+		if resp, body := app.bearerGet(t, path, token); resp.StatusCode != http.StatusOK {
+			t.Errorf("GET %s: want 200, got %s: %s", path, resp.Status, body)
+		}
+	}
+
+	// its use is recorded
+	tokens, err := app.db.ListAccessTokens(testClientID, webextest.DEFAULT_PERSON_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].LastUsedAt.IsZero() {
+		t.Errorf("want the last use recorded, got %+v", tokens)
+	}
+	if _, body := app.get(t, "/settings"); strings.Contains(body, "Never") {
+		t.Errorf("want the last use shown, got: %s", body)
+	}
+
+	// once revoked it is rejected
+	resp, err := app.browser.PostForm(app.server.URL+"/settings/revoke", url.Values{"id": {tokens[0].ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); resp.Request.URL.Path != "/settings" || !strings.Contains(body, "No access token") {
+		t.Errorf("want the token removed from the settings page, ended at %s with: %s", resp.Request.URL, body)
+	}
+	resp, body = app.bearerGet(t, "/api/v1/meetings", token)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(body, errInvalidToken.Error()) ||
+		!strings.Contains(resp.Header.Get("WWW-Authenticate"), "invalid_token") {
+		t.Errorf("want 401 for a revoked token, got %s: %s", resp.Status, body)
+	}
+}
+
+func TestAccessTokenInvalid(t *testing.T) {
+	app := newTestApp(t)
+
+	for _, token := range []string{"", "wxpat_unknown", "not-a-token"} {
+		resp, body := app.bearerGet(t, "/api/v1/meetings", token)
+		if resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("token %q: want 401, got %s: %s", token, resp.Status, body)
+		}
+	}
+}
+
+func TestAccessTokenOutlivesSession(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+	token := app.createToken(t, "script")
+
+	// the token keeps working once the browser session is gone
+	if err := app.db.DeleteSession(app.sessionID(t)); err != nil {
+		t.Fatal(err)
+	}
+	if resp, body := app.bearerGet(t, "/api/v1/meetings", token); resp.StatusCode != http.StatusOK {
+		t.Errorf("want 200, got %s: %s", resp.Status, body)
+	}
+
+	// logging in again from another browser, the token is still listed and can be revoked
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.browser = &http.Client{Jar: jar}
+	app.login(t)
+	if _, body := app.get(t, "/settings"); !strings.Contains(body, "script") {
+		t.Errorf("want the token listed after logging in again: %s", body)
+	}
+
+	tokens, err := app.db.ListAccessTokens(testClientID, webextest.DEFAULT_PERSON_ID)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("want 1 token, got %+v, %v", tokens, err)
+	}
+	resp, err := app.browser.PostForm(app.server.URL+"/settings/revoke", url.Values{"id": {tokens[0].ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); resp.Request.URL.Path != "/settings" || !strings.Contains(body, "No access token") {
+		t.Errorf("want the token revoked, ended at %s with: %s", resp.Request.URL, body)
+	}
+}
+
+func TestAccessTokenExpires(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+	token := app.createToken(t, "expiring")
+
+	app.tokens.clock = func() time.Time { return time.Now().Add(ACCESS_TOKEN_TTL) }
+	resp, body := app.bearerGet(t, "/api/v1/meetings", token)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(body, "expired") {
+		t.Errorf("want 401 for an expired token, got %s: %s", resp.Status, body)
+	}
+
+	// the expired token stays listed so it can be told apart and revoked
+	if _, body := app.get(t, "/settings"); !strings.Contains(body, "expiring") || !strings.Contains(body, "Expired") {
+		t.Errorf("want the token listed as expired: %s", body)
+	}
+}
+
+func TestAccessTokenRefreshIsSaved(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+	token := app.createToken(t, "refresh")
+
+	before, err := app.db.RetrieveCredentials(testClientID, webextest.DEFAULT_PERSON_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app.webex.ExpireAccessTokens()
+	if resp, body := app.bearerGet(t, "/api/v1/meetings", token); resp.StatusCode != http.StatusOK {
+		t.Fatalf("want 200 after a refresh, got %s: %s", resp.Status, body)
+	}
+
+	// the refresh is saved to the credentials the session uses as well
+	after, err := app.db.RetrieveCredentials(testClientID, webextest.DEFAULT_PERSON_ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if before == after {
+		t.Errorf("want the refreshed Webex tokens saved to the credentials")
+	}
+	refreshes := app.webex.Calls("/v1/access_token")
+	if resp, body := app.get(t, "/get_meetings_page"); resp.Request.URL.Path != "/get_meetings_page" {
+		t.Fatalf("meetings page ended at %s with: %s", resp.Request.URL, body)
+	}
+	if got := app.webex.Calls("/v1/access_token"); got != refreshes {
+		t.Errorf("want the session to use the refreshed token, got %d more refreshes", got-refreshes)
+	}
+}
+
+func TestRevokeOtherUsersToken(t *testing.T) {
+	app := newTestApp(t)
+	app.login(t)
+	app.createToken(t, "mine")
+	tokens, err := app.db.ListAccessTokens(testClientID, webextest.DEFAULT_PERSON_ID)
+	if err != nil || len(tokens) != 1 {
+		t.Fatalf("want 1 token, got %+v, %v", tokens, err)
+	}
+
+	// another user logs in from another browser
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.browser = &http.Client{Jar: jar}
+	app.webex.SignInAs("other-person")
+	app.login(t)
+
+	resp, err := app.browser.PostForm(app.server.URL+"/settings/revoke", url.Values{"id": {tokens[0].ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); resp.Request.URL.Path != "/error" || !strings.Contains(body, "does not exist") {
+		t.Errorf("want the error page, ended at %s with: %s", resp.Request.URL, body)
+	}
+	if _, body := app.get(t, "/settings"); strings.Contains(body, "mine") {
+		t.Errorf("the tokens of another user are listed: %s", body)
+	}
+}
+
+func TestSettingsRequireSession(t *testing.T) {
+	app := newTestApp(t)
+
+	for _, path := range []string{"/settings"} {
+		resp, body := app.get(t, path)
+		if resp.Request.URL.Path != "/error" || !strings.Contains(body, errNoSession.Error()) {
+			t.Errorf("GET %s: want the error page, ended at %s", path, resp.Request.URL)
+		}
+	}
+	resp, err := app.browser.PostForm(app.server.URL+"/settings", url.Values{"name": {"x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if readBody(t, resp); resp.Request.URL.Path != "/error" {
+		t.Errorf("want the error page, ended at %s", resp.Request.URL)
+	}
+}
+
+// sessionID is the ID of the browser's session.
+func (a *testApp) sessionID(t *testing.T) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, a.server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cookie := range a.browser.Jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+	id, err := a.sessions.id(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
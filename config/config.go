@@ -0,0 +1,457 @@
+// Package config loads the configuration of the server from a YAML or TOML file, the environment and
+// the command-line flags, each source overriding the previous one.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Defaults of the configuration.
+const (
+	DEFAULT_LISTEN_ADDR         = ":3000"
+	DEFAULT_DATABASE_DSN        = "./persist/webex.db"
+	DEFAULT_TEMPLATE_DIR        = "./templates"
+	DEFAULT_SESSION_TTL         = 7 * 24 * time.Hour
+	DEFAULT_QUALITIES_CACHE_TTL = 0
+)
+
+// REDACTED replaces the secrets when the configuration is printed.
+const REDACTED = "<redacted>"
+
+// Config is the configuration of the server.
+type Config struct {
+	// Host is the public URL of the server, Webex redirects the users to <Host>/auth.
+	Host string `yaml:"host" toml:"host"`
+	// ListenAddr is the address the server listens on.
+	ListenAddr string `yaml:"listen_addr" toml:"listen_addr"`
+	// DatabaseDSN is the data source name of the SQLite database.
+	DatabaseDSN string `yaml:"database_dsn" toml:"database_dsn"`
+	// Dev makes the server read the HTML templates from TemplateDir and reload them on every render,
+	// instead of using the templates embedded in the binary.
+	Dev bool `yaml:"dev" toml:"dev"`
+	// TemplateDir is the directory of the HTML templates in dev mode.
+	TemplateDir string `yaml:"template_dir" toml:"template_dir"`
+
+	TLS   TLS   `yaml:"tls" toml:"tls"`
+	Webex Webex `yaml:"webex" toml:"webex"`
+
+	// Integrations are registered on startup, along with the ones of IntegrationsFile.
+	Integrations     []Integration `yaml:"integrations" toml:"integrations"`
+	IntegrationsFile string        `yaml:"integrations_file" toml:"integrations_file"`
+	// Features are the names of the enabled features, all of them when empty.
+	Features []string `yaml:"features" toml:"features"`
+
+	Cookies Cookies `yaml:"cookies" toml:"cookies"`
+	Cache   Cache   `yaml:"cache" toml:"cache"`
+
+	// PrintConfig is set by the --print-config flag, the server prints the configuration and exits.
+	PrintConfig bool `yaml:"-" toml:"-"`
+}
+
+// TLS is served when both files are set.
+type TLS struct {
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+}
+
+// Enabled tells whether the server is served over TLS.
+func (t TLS) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// Webex is where the Webex API is reached, empty fields fall back to the public Webex API.
+type Webex struct {
+	BaseURL          string   `yaml:"base_url" toml:"base_url"`
+	AnalyticsBaseURL string   `yaml:"analytics_base_url" toml:"analytics_base_url"`
+	UserAgent        string   `yaml:"user_agent" toml:"user_agent"`
+	Timeout          Duration `yaml:"timeout" toml:"timeout"`
+}
+
+// Integration is a Webex integration users can authorize.
+type Integration struct {
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"`
+	Scopes       []string `yaml:"scopes" toml:"scopes"`
+	Label        string   `yaml:"label" toml:"label"`
+}
+
+// Cookies are the keys the cookies are sealed with, in the "<ID>:<base64 key>[:<expiry>]" format.
+type Cookies struct {
+	Keys    []string `yaml:"keys" toml:"keys"`
+	KeyFile string   `yaml:"key_file" toml:"key_file"`
+}
+
+// Cache holds how long data is kept.
+type Cache struct {
+	// SessionTTL is how long a user stays authenticated after logging in, using the server does not extend it.
+	SessionTTL Duration `yaml:"session_ttl" toml:"session_ttl"`
+	// QualitiesTTL is how long fetched meeting qualities are served without asking Webex again, 0 disables it.
+	QualitiesTTL Duration `yaml:"qualities_ttl" toml:"qualities_ttl"`
+}
+
+// Duration is a time.Duration written as "30s" or "5m" in the file, the environment and the flags.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Default is the configuration used for what no source sets.
+func Default() Config {
+	return Config{
+		ListenAddr:  DEFAULT_LISTEN_ADDR,
+		DatabaseDSN: DEFAULT_DATABASE_DSN,
+		TemplateDir: DEFAULT_TEMPLATE_DIR,
+		Cache: Cache{
+			SessionTTL:   Duration{DEFAULT_SESSION_TTL},
+			QualitiesTTL: Duration{DEFAULT_QUALITIES_CACHE_TTL},
+		},
+	}
+}
+
+// Load loads the configuration from the file named by the --config flag or the CONFIG_FILE environment variable,
+// then the environment and then the flags of args, args not including the program name.
+// lookupEnv is usually os.LookupEnv. The configuration is validated.
+func Load(args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("webex", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config", "", "YAML or TOML configuration `file`")
+	printConfig := fs.Bool("print-config", false, "print the configuration and exit")
+	flags := map[string]*flagValue{}
+	for _, v := range variables {
+		if v.flag != "" {
+			flags[v.flag] = &flagValue{isBool: v.isBool}
+			fs.Var(flags[v.flag], v.flag, v.usage)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", fs.Args())
+	}
+
+	// the file
+	if *configFile == "" {
+		*configFile, _ = lookupEnv("CONFIG_FILE")
+	}
+	if *configFile != "" {
+		if err := cfg.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// the environment
+	for _, v := range variables {
+		if value, ok := lookupEnv(v.env); ok && value != "" {
+			if err := v.set(&cfg, value); err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", v.env, err)
+			}
+		}
+	}
+	if err := cfg.loadEnvIntegration(lookupEnv); err != nil {
+		return nil, err
+	}
+
+	// the flags that were set
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, v := range variables {
+			if err == nil && v.flag == f.Name {
+				if e := v.set(&cfg, flags[v.flag].value); e != nil {
+					err = fmt.Errorf("invalid -%s: %w", v.flag, e)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.PrintConfig = *printConfig
+	cfg.Host = strings.TrimSuffix(cfg.Host, "/")
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// variable is a setting that can be set from the environment and from a flag.
+type variable struct {
+	env   string
+	flag  string
+	usage string
+	set   func(cfg *Config, value string) error
+	// isBool lets the flag be set without a value, e.g. -dev
+	isBool bool
+}
+
+// flagValue is the value of a flag, parsed by the set function of its variable.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+var variables = []variable{
+	{"HOST", "host", "public `URL` of the server", setString(func(c *Config) *string { return &c.Host }), false},
+	{"LISTEN_ADDR", "listen", "`address` the server listens on", setString(func(c *Config) *string { return &c.ListenAddr }), false},
+	{"DATABASE_DSN", "db", "SQLite data source `name`", setString(func(c *Config) *string { return &c.DatabaseDSN }), false},
+	{"DEV", "dev", "read the HTML templates from the template directory and reload them on every render", setBool(func(c *Config) *bool { return &c.Dev }), true},
+	{"TEMPLATE_DIR", "templates", "`directory` of the HTML templates in dev mode", setString(func(c *Config) *string { return &c.TemplateDir }), false},
+	{"TLS_CERT_FILE", "tls-cert", "TLS certificate `file`", setString(func(c *Config) *string { return &c.TLS.CertFile }), false},
+	{"TLS_KEY_FILE", "tls-key", "TLS private key `file`", setString(func(c *Config) *string { return &c.TLS.KeyFile }), false},
+	{"WEBEX_BASE_URL", "webex-base-url", "`URL` of the Webex REST API", setString(func(c *Config) *string { return &c.Webex.BaseURL }), false},
+	{"WEBEX_ANALYTICS_BASE_URL", "webex-analytics-base-url", "`URL` of the Webex analytics API", setString(func(c *Config) *string { return &c.Webex.AnalyticsBaseURL }), false},
+	{"WEBEX_USER_AGENT", "webex-user-agent", "User-Agent sent to Webex", setString(func(c *Config) *string { return &c.Webex.UserAgent }), false},
+	{"WEBEX_TIMEOUT", "webex-timeout", "timeout of a Webex request", setDuration(func(c *Config) *Duration { return &c.Webex.Timeout }), false},
+	{"WEBEX_INTEGRATIONS_FILE", "integrations-file", "JSON `file` of the Webex integrations", setString(func(c *Config) *string { return &c.IntegrationsFile }), false},
+	{"WEBEX_FEATURES", "features", "comma separated `list` of the enabled features", setList(func(c *Config) *[]string { return &c.Features }), false},
+	{"COOKIE_KEYS", "", "", setList(func(c *Config) *[]string { return &c.Cookies.Keys }), false},
+	{"COOKIE_KEY_FILE", "cookie-key-file", "`file` of the cookie keys", setString(func(c *Config) *string { return &c.Cookies.KeyFile }), false},
+	{"SESSION_TTL", "session-ttl", "how long a user stays authenticated after logging in", setDuration(func(c *Config) *Duration { return &c.Cache.SessionTTL }), false},
+	{"QUALITIES_CACHE_TTL", "qualities-cache-ttl", "how long meeting qualities are cached, 0 disables it", setDuration(func(c *Config) *Duration { return &c.Cache.QualitiesTTL }), false},
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		*field(cfg) = strings.TrimSpace(value)
+		return nil
+	}
+}
+
+func setBool(field func(*Config) *bool) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return err
+		}
+		*field(cfg) = b
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *Duration) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		return field(cfg).UnmarshalText([]byte(strings.TrimSpace(value)))
+	}
+}
+
+func setList(field func(*Config) *[]string) func(*Config, string) error {
+	return func(cfg *Config, value string) error {
+		list := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(cfg) = list
+		return nil
+	}
+}
+
+// loadFile decodes the file over the configuration, the format is given by the extension.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil && err != io.EOF {
+			return fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("invalid configuration file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("invalid configuration file %s: unknown field %s", path, undecoded[0])
+		}
+	default:
+		return fmt.Errorf("configuration file %s must be .yaml, .yml or .toml", path)
+	}
+
+	return nil
+}
+
+// loadEnvIntegration adds the integration of the WEBEX_CLIENT_ID, WEBEX_CLIENT_SECRET, WEBEX_SCOPES and
+// WEBEX_INTEGRATION_LABEL environment variables. The client secret is not accepted as a flag so it does not show
+// in the process list.
+func (c *Config) loadEnvIntegration(lookupEnv func(string) (string, bool)) error {
+	clientID, _ := lookupEnv("WEBEX_CLIENT_ID")
+	clientSecret, _ := lookupEnv("WEBEX_CLIENT_SECRET")
+	if clientID == "" && clientSecret == "" {
+		return nil
+	}
+
+	integration := Integration{
+		ClientID:     strings.TrimSpace(clientID),
+		ClientSecret: strings.TrimSpace(clientSecret),
+	}
+	if scopes, _ := lookupEnv("WEBEX_SCOPES"); scopes != "" {
+		integration.Scopes = strings.FieldsFunc(scopes, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	integration.Label, _ = lookupEnv("WEBEX_INTEGRATION_LABEL")
+
+	// the environment overrides the integration of the file with the same client ID
+	for i := range c.Integrations {
+		if c.Integrations[i].ClientID == integration.ClientID {
+			c.Integrations[i] = integration
+			return nil
+		}
+	}
+	c.Integrations = append(c.Integrations, integration)
+	return nil
+}
+
+// Validate checks the configuration, all the problems are reported at once.
+func (c *Config) Validate() error {
+	problems := []string{}
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if c.Host == "" {
+		report("host is required, it is the public URL of the server")
+	} else if u, err := url.Parse(c.Host); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		report("host %q must be an http or https URL", c.Host)
+	}
+
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		report("listen_addr %q must be a host:port address", c.ListenAddr)
+	}
+	if c.DatabaseDSN == "" {
+		report("database_dsn is required")
+	}
+	if info, err := os.Stat(c.TemplateDir); c.Dev && (err != nil || !info.IsDir()) {
+		report("template_dir %q is not a directory", c.TemplateDir)
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		report("tls needs both cert_file and key_file")
+	}
+	for _, file := range []string{c.TLS.CertFile, c.TLS.KeyFile} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			report("tls file %q is not readable: %s", file, err.Error())
+		}
+	}
+
+	for name, value := range map[string]string{"webex.base_url": c.Webex.BaseURL, "webex.analytics_base_url": c.Webex.AnalyticsBaseURL} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || !u.IsAbs() {
+			report("%s %q must be an absolute URL", name, value)
+		}
+	}
+	if c.Webex.Timeout.Duration < 0 {
+		report("webex.timeout must not be negative")
+	}
+
+	seen := map[string]bool{}
+	for i, integration := range c.Integrations {
+		if integration.ClientID == "" || integration.ClientSecret == "" {
+			report("integration %d needs a client_id and a client_secret", i+1)
+		}
+		if seen[integration.ClientID] {
+			report("integration %d has the duplicate client_id %s", i+1, integration.ClientID)
+		}
+		seen[integration.ClientID] = true
+	}
+	if c.IntegrationsFile != "" {
+		if _, err := os.Stat(c.IntegrationsFile); err != nil {
+			report("integrations_file %q is not readable: %s", c.IntegrationsFile, err.Error())
+		}
+	}
+
+	if len(c.Cookies.Keys) > 0 && c.Cookies.KeyFile != "" {
+		report("cookies needs either keys or key_file, not both")
+	}
+
+	if c.Cache.SessionTTL.Duration <= 0 {
+		report("cache.session_ttl must be positive")
+	}
+	if c.Cache.QualitiesTTL.Duration < 0 {
+		report("cache.qualities_ttl must not be negative")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// Print writes the configuration as YAML, the secrets are redacted.
+func (c Config) Print(w io.Writer) error {
+	c.Integrations = append([]Integration{}, c.Integrations...)
+	for i := range c.Integrations {
+		c.Integrations[i].ClientSecret = REDACTED
+	}
+
+	keys := make([]string, 0, len(c.Cookies.Keys))
+	for _, key := range c.Cookies.Keys {
+		id, _, _ := strings.Cut(key, ":")
+		keys = append(keys, id+":"+REDACTED)
+	}
+	c.Cookies.Keys = keys
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
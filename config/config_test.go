@@ -0,0 +1,191 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env is a lookupEnv reading from a map.
+func env(vars map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := vars[key]
+		return value, ok
+	}
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	templates := t.TempDir()
+	cfg, err := Load([]string{"-dev", "-templates", templates}, env(map[string]string{"HOST": "http://localhost:3000/"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Default()
+	want.Host = "http://localhost:3000"
+	want.Dev = true
+	want.TemplateDir = templates
+	if !reflect.DeepEqual(*cfg, want) {
+		t.Errorf("want %+v, got %+v", want, *cfg)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	templates := t.TempDir()
+	yamlFile := writeFile(t, "webex.yaml", `
+host: https://file.example.com
+listen_addr: ":4000"
+database_dsn: file.db
+template_dir: `+templates+`
+features: [meetings]
+integrations:
+  - client_id: c1
+    client_secret: from file
+    label: File
+cache:
+  session_ttl: 1h
+  qualities_ttl: 0s
+`)
+	tomlFile := writeFile(t, "webex.toml", `
+host = "https://file.example.com"
+listen_addr = ":4000"
+database_dsn = "file.db"
+template_dir = "`+templates+`"
+features = ["meetings"]
+
+[[integrations]]
+client_id = "c1"
+client_secret = "from file"
+label = "File"
+
+[cache]
+session_ttl = "1h"
+qualities_ttl = "0s"
+`)
+
+	for _, file := range []string{yamlFile, tomlFile} {
+		t.Run(filepath.Ext(file), func(t *testing.T) {
+			cfg, err := Load([]string{"-listen", ":6000"}, env(map[string]string{
+				"CONFIG_FILE":         file,
+				"LISTEN_ADDR":         ":5000",
+				"DATABASE_DSN":        "env.db",
+				"WEBEX_CLIENT_ID":     "c1",
+				"WEBEX_CLIENT_SECRET": "from env",
+				"QUALITIES_CACHE_TTL": "",
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.Host != "https://file.example.com" {
+				t.Errorf("want the host of the file, got %s", cfg.Host)
+			}
+			if cfg.DatabaseDSN != "env.db" {
+				t.Errorf("want the environment over the file, got %s", cfg.DatabaseDSN)
+			}
+			if cfg.ListenAddr != ":6000" {
+				t.Errorf("want the flag over the environment, got %s", cfg.ListenAddr)
+			}
+			if !reflect.DeepEqual(cfg.Features, []string{"meetings"}) {
+				t.Errorf("unexpected features %v", cfg.Features)
+			}
+			if len(cfg.Integrations) != 1 || cfg.Integrations[0].ClientSecret != "from env" {
+				t.Errorf("want the integration of the environment over the file, got %+v", cfg.Integrations)
+			}
+			if cfg.Cache.SessionTTL.Duration != time.Hour || cfg.Cache.QualitiesTTL.Duration != 0 {
+				t.Errorf("unexpected cache TTLs %+v", cfg.Cache)
+			}
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	templates := t.TempDir()
+	host := map[string]string{"HOST": "http://localhost"}
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{name: "unknown field", args: []string{"-config", writeFile(t, "c.yaml", "hots: http://localhost\n")}, env: host, want: "field hots not found"},
+		{name: "unknown toml field", args: []string{"-config", writeFile(t, "c.toml", "hots = \"http://localhost\"\n")}, env: host, want: "unknown field hots"},
+		{name: "unknown format", args: []string{"-config", writeFile(t, "c.json", "{}")}, env: host, want: "must be .yaml"},
+		{name: "invalid duration", args: []string{"-templates", templates}, env: map[string]string{"HOST": "http://localhost", "SESSION_TTL": "a week"}, want: "invalid SESSION_TTL"},
+		{name: "unknown flag", args: []string{"-colour"}, env: host, want: "flag provided but not defined"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Load(test.args, env(test.env))
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("want an error containing %q, got %v", test.want, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := Default()
+	cfg.Host = "localhost"
+	cfg.ListenAddr = "3000"
+	cfg.Dev = true
+	cfg.TemplateDir = filepath.Join(t.TempDir(), "missing")
+	cfg.TLS.CertFile = "cert.pem"
+	cfg.Integrations = []Integration{{ClientID: "c1"}}
+	cfg.Cookies = Cookies{Keys: []string{"k1:a2V5"}, KeyFile: "keys"}
+	cfg.Cache.SessionTTL.Duration = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("want an error")
+	}
+	// all the problems are reported at once
+	for _, want := range []string{"host", "listen_addr", "template_dir", "tls", "integration 1", "cookies", "session_ttl"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("want %q reported: %s", want, err)
+		}
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Host = "http://localhost"
+	cfg.Integrations = []Integration{{ClientID: "c1", ClientSecret: "client secret"}}
+	cfg.Cookies.Keys = []string{"2024-06:c2VjcmV0IGtleQ=="}
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"client secret", "c2VjcmV0IGtleQ=="} {
+		if strings.Contains(out, secret) {
+			t.Errorf("the printed configuration leaks %q:\n%s", secret, out)
+		}
+	}
+	for _, want := range []string{"client_id: c1", "2024-06:" + REDACTED, "session_ttl: 168h0m0s"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("want %q printed:\n%s", want, out)
+		}
+	}
+	// the configuration itself is untouched
+	if cfg.Integrations[0].ClientSecret != "client secret" {
+		t.Errorf("Print modified the configuration")
+	}
+}
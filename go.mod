@@ -4,4 +4,20 @@ go 1.18
 
 require github.com/mattn/go-sqlite3 v1.14.12
 
-require github.com/brianvoe/gofakeit/v6 v6.16.0
+require (
+	github.com/BurntSushi/toml v1.2.1
+	github.com/brianvoe/gofakeit/v6 v6.16.0
+	github.com/getkin/kin-openapi v0.112.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/go-openapi/jsonpointer v0.19.5 // indirect
+	github.com/go-openapi/swag v0.19.15 // indirect
+	github.com/gorilla/mux v1.8.0 // indirect
+	github.com/invopop/yaml v0.1.0 // indirect
+	github.com/josharian/intern v1.0.0 // indirect
+	github.com/mailru/easyjson v0.7.6 // indirect
+	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
+	gopkg.in/yaml.v2 v2.4.0 // indirect
+)
@@ -1,30 +1,64 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 
 	_ "github.com/mattn/go-sqlite3"
 
 	"Webex.API.Integration.And.Visualization/api"
+	"Webex.API.Integration.And.Visualization/config"
 	"Webex.API.Integration.And.Visualization/persist"
 )
 
 func main() {
+	if err := run(); err != nil {
+		log.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	// Load the configuration from the file, the environment and the flags.
+	cfg, err := config.Load(os.Args[1:], os.LookupEnv)
+	if err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if cfg.PrintConfig {
+		return cfg.Print(os.Stdout)
+	}
+
 	// Initialize the sqlite db.
-	db, err := sql.Open("sqlite3", "./persist/webex.db")
+	db, err := sql.Open("sqlite3", cfg.DatabaseDSN)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer db.Close()
 
 	p, err := persist.NewPersist(db)
 	if err != nil {
-		log.Fatal(err)
+		db.Close()
+		return err
 	}
 
-	// Start the server and close if error occurs
-	if err := api.WebexApplicationServer(p); err != nil {
-		panic(err)
+	server, err := api.NewServer(p, cfg)
+	if err != nil {
+		p.Close()
+		return err
 	}
+
+	// Serve until SIGINT or SIGTERM, the in-flight requests are drained and the db is closed by Run.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	log.Printf("listening on %s\n", cfg.ListenAddr)
+	return server.Run(ctx)
 }
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"Webex.API.Integration.And.Visualization/types"
 )
@@ -16,9 +18,79 @@ type Persist struct {
 
 // NewPersist create a new instance of Persits provided a database pointer.
 func NewPersist(db *sql.DB) (*Persist, error) {
+	// the meeting qualities saved before they were kept per user cannot be told apart, they are dropped
+	perUser, err := hasColumn(db, "meeting_qualities", "person_id")
+	if err != nil {
+		return nil, err
+	}
+	if !perUser {
+		if _, err := db.Exec("DROP TABLE IF EXISTS meeting_qualities"); err != nil {
+			return nil, err
+		}
+	}
+
 	// create if not exists the table
-	_, err := db.Exec(
-		"CREATE TABLE IF NOT EXISTS meeting_qualities (meeting_id TEXT PRIMARY KEY, client_id TEXT, data_dump TEXT)",
+	_, err = db.Exec(
+		"CREATE TABLE IF NOT EXISTS meeting_qualities (client_id TEXT, person_id TEXT, meeting_id TEXT, data_dump TEXT, saved_at INTEGER, " +
+			"PRIMARY KEY (client_id, person_id, meeting_id))",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sessions and the access tokens saved before they referenced the credentials held copies of them,
+	// with the client secret, they are dropped and the users authenticate again
+	for _, table := range []string{"sessions", "access_tokens"} {
+		referencing, err := hasColumn(db, table, "person_id")
+		if err != nil {
+			return nil, err
+		}
+		if !referencing {
+			if _, err := db.Exec("DROP TABLE IF EXISTS " + table); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_, err = db.Exec(
+		"CREATE TABLE IF NOT EXISTS credentials (client_id TEXT, person_id TEXT, data TEXT, PRIMARY KEY (client_id, person_id))",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(
+		"CREATE TABLE IF NOT EXISTS sessions (id TEXT PRIMARY KEY, client_id TEXT, person_id TEXT, expires_at INTEGER)",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(
+		"CREATE TABLE IF NOT EXISTS integrations (client_id TEXT PRIMARY KEY, client_secret TEXT, scopes TEXT, label TEXT, source TEXT NOT NULL DEFAULT 'manual')",
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// databases created before the integrations were synced with the configuration lack the source column,
+	// their integrations were all saved from the configuration
+	synced, err := hasColumn(db, "integrations", "source")
+	if err != nil {
+		return nil, err
+	}
+	if !synced {
+		if err := addColumn(db, "integrations", "source", "TEXT NOT NULL DEFAULT 'manual'"); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec("UPDATE integrations SET source = 'config'"); err != nil {
+			return nil, err
+		}
+	}
+
+	_, err = db.Exec(
+		"CREATE TABLE IF NOT EXISTS access_tokens (id TEXT PRIMARY KEY, hash TEXT UNIQUE, client_id TEXT, person_id TEXT, name TEXT, " +
+			"created_at INTEGER, last_used_at INTEGER, expires_at INTEGER)",
 	)
 	if err != nil {
 		return nil, err
@@ -27,29 +99,39 @@ func NewPersist(db *sql.DB) (*Persist, error) {
 	return &Persist{db}, nil
 }
 
+// Close closes the database, the Persist can no longer be used.
+func (p *Persist) Close() error {
+	return p.db.Close()
+}
+
 // Save the Webex analytics data to persitence storage.
 // One can only make one call per 5 min for analytics data for single ID.
-// This function assumes the successful authorization happened for client_id.
-func (p *Persist) SaveAnalyticsData(meetingID, clientID, dataDump string) error {
+// The data is kept for the Webex user person_id who fetched it through client_id, other users never get it.
+func (p *Persist) SaveAnalyticsData(meetingID, clientID, personID, dataDump string) error {
 	// validate that the data dump is non-empty
 	if len(dataDump) == 0 {
 		return fmt.Errorf("data dump is empty")
 	}
 
+	// the data must belong to a user
+	if len(personID) == 0 {
+		return fmt.Errorf("person id is empty")
+	}
+
 	// save data to db, replace if already exists
-	_, err := p.db.Exec("REPLACE INTO meeting_qualities (meeting_id, client_id, data_dump) VALUES (?, ?, ?)",
-		meetingID, clientID, dataDump)
+	_, err := p.db.Exec("REPLACE INTO meeting_qualities (client_id, person_id, meeting_id, data_dump, saved_at) VALUES (?, ?, ?, ?, ?)",
+		clientID, personID, meetingID, dataDump, time.Now().Unix())
 	return err
 }
 
-// RetieveAnalyticsData retrieves the analytics data for a given meeting if present.
-// This function assumes the successful authorization happened for client_id.
-func (p *Persist) RetriveAnalyticsData(clientID, meetingID string) (*types.MeetingQualities, error) {
+// RetieveAnalyticsData retrieves the analytics data for a given meeting if the user saved it.
+// This function assumes the successful authorization happened for client_id and person_id.
+func (p *Persist) RetriveAnalyticsData(clientID, personID, meetingID string) (*types.MeetingQualities, error) {
 	var data types.MeetingQualities
 	var dataDump string
 	if err := p.db.QueryRow(
-		"SELECT data_dump FROM meeting_qualities WHERE client_id = ? AND meeting_id = ?",
-		clientID, meetingID,
+		"SELECT data_dump FROM meeting_qualities WHERE client_id = ? AND person_id = ? AND meeting_id = ?",
+		clientID, personID, meetingID,
 	).Scan(&dataDump); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -64,3 +146,304 @@ func (p *Persist) RetriveAnalyticsData(clientID, meetingID string) (*types.Meeti
 	data.MeetingID = meetingID
 	return &data, nil
 }
+
+// RetrieveRecentAnalyticsData retrieves the analytics data for a given meeting if the user saved it less than maxAge ago.
+// This function assumes the successful authorization happened for client_id and person_id.
+func (p *Persist) RetrieveRecentAnalyticsData(clientID, personID, meetingID string, maxAge time.Duration) (*types.MeetingQualities, error) {
+	var savedAt sql.NullInt64
+	if err := p.db.QueryRow(
+		"SELECT saved_at FROM meeting_qualities WHERE client_id = ? AND person_id = ? AND meeting_id = ?",
+		clientID, personID, meetingID,
+	).Scan(&savedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// rows saved without a time are never recent
+	if !savedAt.Valid || time.Since(time.Unix(savedAt.Int64, 0)) >= maxAge {
+		return nil, nil
+	}
+	return p.RetriveAnalyticsData(clientID, personID, meetingID)
+}
+
+// SaveCredentials saves the Webex authorization the user person_id granted to the integration client_id,
+// replacing the previous one. The data must not hold the client secret.
+func (p *Persist) SaveCredentials(clientID, personID, data string) error {
+	if len(clientID) == 0 || len(personID) == 0 {
+		return fmt.Errorf("credentials client id or person id is empty")
+	}
+
+	_, err := p.db.Exec("REPLACE INTO credentials (client_id, person_id, data) VALUES (?, ?, ?)",
+		clientID, personID, data)
+	return err
+}
+
+// RetrieveCredentials retrieves the Webex authorization of the user for the integration, it is empty if there is none.
+func (p *Persist) RetrieveCredentials(clientID, personID string) (string, error) {
+	var data string
+	if err := p.db.QueryRow(
+		"SELECT data FROM credentials WHERE client_id = ? AND person_id = ?",
+		clientID, personID,
+	).Scan(&data); err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return data, nil
+}
+
+// SaveSession saves a session of the user person_id of the integration client_id until it expires,
+// replacing it if it already exists.
+func (p *Persist) SaveSession(id, clientID, personID string, expiresAt time.Time) error {
+	if len(id) == 0 {
+		return fmt.Errorf("session id is empty")
+	}
+
+	_, err := p.db.Exec("REPLACE INTO sessions (id, client_id, person_id, expires_at) VALUES (?, ?, ?, ?)",
+		id, clientID, personID, expiresAt.Unix())
+	return err
+}
+
+// RetrieveSession retrieves the integration and the user of a session, they are empty if the session does not exist or has expired.
+func (p *Persist) RetrieveSession(id string) (string, string, error) {
+	var clientID, personID string
+	if err := p.db.QueryRow(
+		"SELECT client_id, person_id FROM sessions WHERE id = ? AND expires_at > ?",
+		id, time.Now().Unix(),
+	).Scan(&clientID, &personID); err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+
+	return clientID, personID, nil
+}
+
+// DeleteSession deletes a session, deleting a session that does not exist is not an error.
+func (p *Persist) DeleteSession(id string) error {
+	_, err := p.db.Exec("DELETE FROM sessions WHERE id = ?", id)
+	return err
+}
+
+// DeleteExpiredSessions deletes the sessions that have expired.
+func (p *Persist) DeleteExpiredSessions() error {
+	_, err := p.db.Exec("DELETE FROM sessions WHERE expires_at <= ?", time.Now().Unix())
+	return err
+}
+
+// SaveIntegration registers a Webex integration users can authorize, replacing it if it already exists.
+// It is registered from the configuration, PruneIntegrations deletes it once it is no longer configured.
+// Integrations inserted in the table directly have the 'manual' source by default, they are kept.
+func (p *Persist) SaveIntegration(integration types.Integration) error {
+	if len(integration.ClientID) == 0 || len(integration.ClientSecret) == 0 {
+		return fmt.Errorf("integration client id and client secret are required")
+	}
+
+	_, err := p.db.Exec("REPLACE INTO integrations (client_id, client_secret, scopes, label, source) VALUES (?, ?, ?, ?, 'config')",
+		integration.ClientID, integration.ClientSecret, strings.Join(integration.Scopes, " "), integration.Label)
+	return err
+}
+
+// RetrieveIntegration retrieves a registered Webex integration, it is nil if the integration does not exist.
+func (p *Persist) RetrieveIntegration(clientID string) (*types.Integration, error) {
+	var integration types.Integration
+	var scopes string
+	if err := p.db.QueryRow(
+		"SELECT client_id, client_secret, COALESCE(scopes, ''), COALESCE(label, client_id) FROM integrations WHERE client_id = ?",
+		clientID,
+	).Scan(&integration.ClientID, &integration.ClientSecret, &scopes, &integration.Label); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	integration.Scopes = strings.Fields(scopes)
+	return &integration, nil
+}
+
+// ListIntegrations lists the registered Webex integrations ordered by label.
+func (p *Persist) ListIntegrations() ([]types.Integration, error) {
+	rows, err := p.db.Query("SELECT client_id, client_secret, COALESCE(scopes, ''), COALESCE(label, client_id) FROM integrations ORDER BY label, client_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	integrations := []types.Integration{}
+	for rows.Next() {
+		var integration types.Integration
+		var scopes string
+		if err := rows.Scan(&integration.ClientID, &integration.ClientSecret, &scopes, &integration.Label); err != nil {
+			return nil, err
+		}
+		integration.Scopes = strings.Fields(scopes)
+		integrations = append(integrations, integration)
+	}
+
+	return integrations, rows.Err()
+}
+
+// DeleteIntegration unregisters a Webex integration, deleting an integration that does not exist is not an error.
+func (p *Persist) DeleteIntegration(clientID string) error {
+	_, err := p.db.Exec("DELETE FROM integrations WHERE client_id = ?", clientID)
+	return err
+}
+
+// PruneIntegrations deletes the integrations registered from the configuration whose client ID is not kept.
+// It returns the client IDs of the deleted integrations.
+func (p *Persist) PruneIntegrations(keep []string) ([]string, error) {
+	rows, err := p.db.Query("SELECT client_id FROM integrations WHERE source = 'config'")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	kept := map[string]bool{}
+	for _, clientID := range keep {
+		kept[clientID] = true
+	}
+	var stale []string
+	for rows.Next() {
+		var clientID string
+		if err := rows.Scan(&clientID); err != nil {
+			return nil, err
+		}
+		if !kept[clientID] {
+			stale = append(stale, clientID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, clientID := range stale {
+		if err := p.DeleteIntegration(clientID); err != nil {
+			return nil, err
+		}
+	}
+	return stale, nil
+}
+
+// SaveAccessToken saves a personal access token of the user person_id of the integration client_id,
+// it authenticates with their credentials. Only the hash of the token is stored.
+func (p *Persist) SaveAccessToken(token types.AccessToken, clientID, personID, hash string) error {
+	if len(token.ID) == 0 || len(hash) == 0 {
+		return fmt.Errorf("access token id or hash is empty")
+	}
+	if len(clientID) == 0 || len(personID) == 0 {
+		return fmt.Errorf("access token client id or person id is empty")
+	}
+
+	_, err := p.db.Exec(
+		"INSERT INTO access_tokens (id, hash, client_id, person_id, name, created_at, last_used_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, 0, ?)",
+		token.ID, hash, clientID, personID, token.Name, token.CreatedAt.Unix(), token.ExpiresAt.Unix(),
+	)
+	return err
+}
+
+// RetrieveAccessToken retrieves the access token with the hash and the integration and user it belongs to, nil if there is none.
+// Expired tokens are retrieved as well, the caller checks their expiry.
+func (p *Persist) RetrieveAccessToken(hash string) (*types.AccessToken, string, string, error) {
+	var token types.AccessToken
+	var clientID, personID string
+	var createdAt, lastUsedAt, expiresAt int64
+	if err := p.db.QueryRow(
+		"SELECT id, client_id, person_id, name, created_at, last_used_at, expires_at FROM access_tokens WHERE hash = ?", hash,
+	).Scan(&token.ID, &clientID, &personID, &token.Name, &createdAt, &lastUsedAt, &expiresAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", "", nil
+		}
+		return nil, "", "", err
+	}
+
+	token.CreatedAt, token.LastUsedAt, token.ExpiresAt = unixTime(createdAt), unixTime(lastUsedAt), unixTime(expiresAt)
+	return &token, clientID, personID, nil
+}
+
+// ListAccessTokens lists the access tokens of the user of the integration, expired ones included, the most recent first.
+func (p *Persist) ListAccessTokens(clientID, personID string) ([]types.AccessToken, error) {
+	rows, err := p.db.Query(
+		"SELECT id, name, created_at, last_used_at, expires_at FROM access_tokens WHERE client_id = ? AND person_id = ? ORDER BY created_at DESC, id",
+		clientID, personID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []types.AccessToken{}
+	for rows.Next() {
+		var token types.AccessToken
+		var createdAt, lastUsedAt, expiresAt int64
+		if err := rows.Scan(&token.ID, &token.Name, &createdAt, &lastUsedAt, &expiresAt); err != nil {
+			return nil, err
+		}
+		token.CreatedAt, token.LastUsedAt, token.ExpiresAt = unixTime(createdAt), unixTime(lastUsedAt), unixTime(expiresAt)
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// TouchAccessToken records when the access token was last used.
+func (p *Persist) TouchAccessToken(id string, usedAt time.Time) error {
+	_, err := p.db.Exec("UPDATE access_tokens SET last_used_at = ? WHERE id = ?", usedAt.Unix(), id)
+	return err
+}
+
+// DeleteAccessToken revokes an access token of the user of the integration, it tells whether the user had such a token.
+func (p *Persist) DeleteAccessToken(clientID, personID, id string) (bool, error) {
+	result, err := p.db.Exec("DELETE FROM access_tokens WHERE client_id = ? AND person_id = ? AND id = ?", clientID, personID, id)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// unixTime is the time of a Unix timestamp column, the zero time for 0.
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+// addColumn adds the column to the table unless it already has it.
+func addColumn(db *sql.DB, table, column, definition string) error {
+	exists, err := hasColumn(db, table, column)
+	if err != nil || exists {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// hasColumn tells whether the table has the column, a table that does not exist has none.
+func hasColumn(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
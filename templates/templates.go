@@ -0,0 +1,9 @@
+// Package templates embeds the HTML templates of the server in the binary.
+package templates
+
+import "embed"
+
+// FS holds the HTML templates.
+//
+//go:embed *.html
+var FS embed.FS
@@ -2,6 +2,8 @@ package types
 
 import (
 	"errors"
+	"fmt"
+	"time"
 )
 
 // AuthResponse is returned on successful authorization. The access token is to be used in susbsequent requests.
@@ -10,6 +12,15 @@ type AuthResponse struct {
 	ExpiresIn             int    `json:"expires_in"`
 	RefreshToken          string `json:"refresh_token"`
 	RefreshTokenExpiresIn int    `json:"refresh_token_expires_in"`
+	// Scope is the space separated list of the scopes granted to the access token, empty if Webex did not tell.
+	Scope string `json:"scope,omitempty"`
+}
+
+// Person is the Webex user an access token was issued to.
+type Person struct {
+	ID          string   `json:"id"`
+	DisplayName string   `json:"displayName"`
+	Emails      []string `json:"emails"`
 }
 
 // HTTP4XXError is returned when the access token is expired or invalid.
@@ -22,10 +33,25 @@ type HTTP4XXError struct {
 	TrackingID string `json:"trackingId"`
 }
 
+// Integration is a Webex integration registered by the operator, users pick one to authorize.
+// The ClientSecret never leaves the server.
+type Integration struct {
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Scopes       []string `json:"scopes"`
+	// Label is the name of the integration shown to the users.
+	Label string `json:"label"`
+}
+
+// OAuthRequest is the OAuth flow in progress, from "/init" until Webex redirects back to "/auth".
+// The client secret is not part of it, it is looked up from the registered integration.
 type OAuthRequest struct {
-	ClientID     string
-	ClientSecret string
-	Scope        string
+	ClientID string
+	Scope    string
+	// State is sent to Webex and must be redirected back unchanged.
+	State string
+	// CodeVerifier is the PKCE secret whose challenge is sent to Webex, it is required to exchange the code.
+	CodeVerifier string
 }
 
 type RefreshTokenRequest struct {
@@ -42,6 +68,28 @@ type GenericPage struct {
 	ShowAPIRedirect  bool
 }
 
+// AccessToken is a personal access token authenticating machine clients on the JSON API.
+// The token itself is only shown once, when it is created.
+type AccessToken struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	// LastUsedAt is the zero time if the token was never used.
+	LastUsedAt time.Time
+	// ExpiresAt is when the token stops authenticating.
+	ExpiresAt time.Time
+}
+
+// ErrorResponse is the body of the JSON API errors.
+type ErrorResponse struct {
+	// Status is the HTTP status code of the response.
+	Status int `json:"status"`
+	// Message describes the error.
+	Message string `json:"message"`
+	// TrackingID identifies the request at Webex when the error comes from Webex.
+	TrackingID string `json:"tracking_id,omitempty"`
+}
+
 type MeetingsList struct {
 	Items []MeetingSeries `json:"items"`
 }
@@ -147,73 +195,316 @@ type MediaQualityData struct {
 	TransportType    string    `json:"transportType"`
 }
 
+// Resources are the CPU usage of the participant's device, in percent, over an interval.
 type Resources struct {
+	SamplingInterval  int       `json:"samplingInterval"`
+	StartTime         string    `json:"startTime"`
+	EndTime           string    `json:"endTime"`
 	ProcessAverageCPU []float32 `json:"processAverageCPU"`
 	ProcessMaxCPU     []float32 `json:"processMaxCPU"`
 	SystemAverageCPU  []float32 `json:"systemAverageCPU"`
 	SystemMaxCPU      []float32 `json:"systemMaxCPU"`
 }
 
+// VisualData is the chart data of a data point of a meeting, broken down by participant.
 type VisualData struct {
-	MeetingID  string    `json:"meeting_id"`
-	DataPoint  string    `json:"data_point"`
-	StartTime  string    `json:"start_time"`
-	EndTime    string    `json:"end_time"`
-	PacketLoss []float32 `json:"packet_loss"`
-	Latency    []float32 `json:"latency"`
-	Jitter     []float32 `json:"jitter"`
+	MeetingID string `json:"meeting_id"`
+	DataPoint string `json:"data_point"`
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	// Participants are in the order they first appear in the meeting qualities.
+	Participants []ParticipantData `json:"participants"`
 }
 
+// ParticipantData is the quality data of a participant, one entry per media session, e.g. when they joined again.
+type ParticipantData struct {
+	// Key identifies the participant: the participant ID, else the email, else the display name.
+	Key         string        `json:"key"`
+	DisplayName string        `json:"display_name"`
+	Email       string        `json:"email"`
+	Sessions    []SessionData `json:"sessions"`
+}
+
+// SessionData are the series of a media session of a participant.
+// The samples are timestamped, a gap between two intervals of quality data shows as a gap between their samples.
+type SessionData struct {
+	StartTime string `json:"start_time"`
+	EndTime   string `json:"end_time"`
+	// SamplingInterval is the time between two samples in seconds.
+	SamplingInterval int      `json:"sampling_interval"`
+	PacketLoss       []Sample `json:"packet_loss"`
+	Latency          []Sample `json:"latency"`
+	Jitter           []Sample `json:"jitter"`
+	MediaBitRate     []Sample `json:"media_bit_rate"`
+	// ResolutionHeight and FrameRate are only sampled for video and share.
+	ResolutionHeight []Sample `json:"resolution_height"`
+	FrameRate        []Sample `json:"frame_rate"`
+	// Changes are the codec and transport of the session from its start, then every time either changed.
+	Changes []MediaChange `json:"changes"`
+	// The CPU usage of the device in percent, only sampled for the resources data point.
+	ProcessAverageCPU []Sample `json:"process_average_cpu"`
+	ProcessMaxCPU     []Sample `json:"process_max_cpu"`
+	SystemAverageCPU  []Sample `json:"system_average_cpu"`
+	SystemMaxCPU      []Sample `json:"system_max_cpu"`
+}
+
+// MediaChange is the codec and transport a media session used from Time on.
+type MediaChange struct {
+	Time          time.Time `json:"time"`
+	Codec         string    `json:"codec"`
+	TransportType string    `json:"transport_type"`
+}
+
+// Sample is a value of a series and the time it was sampled at.
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float32   `json:"value"`
+}
+
+// DATA_POINTS are the data points GetVisualData accepts, in the order of GetAllVisualData.
+var DATA_POINTS = []string{"audio_in", "audio_out", "video_in", "video_out", "share_in", "share_out", "resources"}
+
+// ErrNoQualities is returned for a meeting without meeting qualities, e.g. it has not ended yet.
+// Its message is shown to the users as is.
+var ErrNoQualities = errors.New("No meeting qualities are available for the meeting.")
+
 func GetAllVisualData(qualities *MeetingQualities) ([]VisualData, error) {
-	vData := func(dp string) VisualData {
-		visualData, _ := GetVisualData(qualities, dp)
-		return *visualData
+	all := make([]VisualData, 0, len(DATA_POINTS))
+	for _, dp := range DATA_POINTS {
+		visualData, err := GetVisualData(qualities, dp)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, *visualData)
 	}
 
-	return []VisualData{vData("audio_in"), vData("audio_out"), vData("video_in"),
-		vData("video_out"), vData("share_in"), vData("share_out"),
-	}, nil
+	return all, nil
 }
 
+// GetVisualData breaks the data point of the meeting qualities down by participant.
+// A meeting without media sessions has no participants, its start and end times are empty.
 func GetVisualData(qualities *MeetingQualities, dp string) (*VisualData, error) {
+	if qualities == nil {
+		return nil, ErrNoQualities
+	}
+	if !ValidDataPoint(dp) {
+		return nil, errors.New(`invalid request, "dp" parameter not recognized`)
+	}
+
 	visualData := &VisualData{
-		MeetingID: qualities.MeetingID,
-		DataPoint: dp,
+		MeetingID:    qualities.MeetingID,
+		DataPoint:    dp,
+		Participants: []ParticipantData{},
 	}
+	visualData.StartTime, visualData.EndTime = meetingTimes(qualities)
 
-	for i, session := range qualities.MediaSessions {
-		if i == 0 {
-			visualData.StartTime = session.VideoIn[0].StartTime
-		}
-		if i == len(qualities.MediaSessions)-1 {
-			visualData.EndTime = session.VideoIn[len(session.VideoIn)-1].EndTime
-		}
+	// index of the participants in visualData.Participants by key
+	participants := map[string]int{}
 
+	for _, session := range qualities.MediaSessions {
+		var data []MediaQualityData
+		var resources []Resources
 		switch dp {
 		case "video_in":
-			populateSession(session.VideoIn, visualData)
+			data = session.VideoIn
 		case "video_out":
-			populateSession(session.VideoOut, visualData)
+			data = session.VideoOut
 		case "audio_in":
-			populateSession(session.AudioIn, visualData)
+			data = session.AudioIn
 		case "audio_out":
-			populateSession(session.AudioOut, visualData)
+			data = session.AudioOut
 		case "share_in":
-			populateSession(session.ShareIn, visualData)
+			data = session.ShareIn
 		case "share_out":
-			populateSession(session.ShareOut, visualData)
-		default:
-			return nil, errors.New(`invalid request, "dp" parameter not recognized`)
+			data = session.ShareOut
+		case "resources":
+			resources = session.Resources
+		}
+
+		// a session without data for the data point, e.g. nothing shared, is left out,
+		// as is a session none of whose intervals can be placed in time
+		var sessionData SessionData
+		var ok bool
+		if dp == "resources" {
+			sessionData, ok = populateResources(resources)
+		} else {
+			sessionData, ok = populateSession(data)
+		}
+		if !ok {
+			continue
 		}
+
+		key := participantKey(session)
+		j, ok := participants[key]
+		if !ok {
+			j = len(visualData.Participants)
+			participants[key] = j
+			visualData.Participants = append(visualData.Participants, ParticipantData{
+				Key:         key,
+				DisplayName: session.DisplayName,
+				Email:       session.Email,
+			})
+		}
+		visualData.Participants[j].Sessions = append(visualData.Participants[j].Sessions, sessionData)
 	}
 
 	return visualData, nil
 }
 
-func populateSession(data []MediaQualityData, toAppend *VisualData) {
+// ValidDataPoint tells whether dp is one of DATA_POINTS.
+func ValidDataPoint(dp string) bool {
+	for _, valid := range DATA_POINTS {
+		if dp == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// meetingTimes returns the earliest start and latest end time of the streams of all the media sessions,
+// whichever exist: an audio only participant has no video, a phone participant may have no resources.
+// The intervals whose start or end time cannot be parsed are ignored, as they are not charted.
+func meetingTimes(qualities *MeetingQualities) (startTime, endTime string) {
+	var start, end time.Time
+	span := func(from, to string) {
+		s, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return
+		}
+		e, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return
+		}
+		if start.IsZero() || s.Before(start) {
+			start, startTime = s, from
+		}
+		if end.IsZero() || e.After(end) {
+			end, endTime = e, to
+		}
+	}
+
+	for _, session := range qualities.MediaSessions {
+		for _, stream := range [][]MediaQualityData{session.VideoIn, session.VideoOut, session.AudioIn, session.AudioOut, session.ShareIn, session.ShareOut} {
+			for _, data := range stream {
+				span(data.StartTime, data.EndTime)
+			}
+		}
+		for _, data := range session.Resources {
+			span(data.StartTime, data.EndTime)
+		}
+	}
+
+	return startTime, endTime
+}
+
+// participantKey identifies the participant of the media session across the sessions of the meeting.
+func participantKey(session MediaSessionQuality) string {
+	switch {
+	case session.ParticipantID != "":
+		return session.ParticipantID
+	case session.Email != "":
+		return session.Email
+	default:
+		return session.DisplayName
+	}
+}
+
+// populateSession charts the intervals of a stream of a media session, it tells whether any interval was charted.
+// The intervals whose start or end time cannot be parsed are skipped, meetingTimes ignores them too.
+func populateSession(data []MediaQualityData) (SessionData, bool) {
+	var session SessionData
+	charted := false
 	for _, val := range data {
-		toAppend.PacketLoss = append(toAppend.PacketLoss, val.PacketLoss...)
-		toAppend.Latency = append(toAppend.Latency, val.Latency...)
-		toAppend.Jitter = append(toAppend.Jitter, val.Jitter...)
+		timestamp, err := sampleTimes(val.StartTime, val.EndTime, val.SamplingInterval,
+			val.PacketLoss, val.Latency, val.Jitter, val.MediaBitRate, val.ResolutionHeight, val.FrameRate)
+		if err != nil {
+			continue
+		}
+		if !charted {
+			session.StartTime, session.SamplingInterval = val.StartTime, val.SamplingInterval
+			charted = true
+		}
+		session.EndTime = val.EndTime
+
+		session.PacketLoss = appendSamples(session.PacketLoss, timestamp, val.PacketLoss)
+		session.Latency = appendSamples(session.Latency, timestamp, val.Latency)
+		session.Jitter = appendSamples(session.Jitter, timestamp, val.Jitter)
+		session.MediaBitRate = appendSamples(session.MediaBitRate, timestamp, val.MediaBitRate)
+		session.ResolutionHeight = appendSamples(session.ResolutionHeight, timestamp, val.ResolutionHeight)
+		session.FrameRate = appendSamples(session.FrameRate, timestamp, val.FrameRate)
+
+		// the codec and transport are reported per interval, only the changes are kept
+		if last := len(session.Changes) - 1; last < 0 || session.Changes[last].Codec != val.Codec || session.Changes[last].TransportType != val.TransportType {
+			session.Changes = append(session.Changes, MediaChange{
+				Time:          timestamp(0),
+				Codec:         val.Codec,
+				TransportType: val.TransportType,
+			})
+		}
+	}
+
+	return session, charted
+}
+
+// populateResources charts the CPU usage intervals of a media session like populateSession.
+func populateResources(resources []Resources) (SessionData, bool) {
+	var session SessionData
+	charted := false
+	for _, val := range resources {
+		timestamp, err := sampleTimes(val.StartTime, val.EndTime, val.SamplingInterval,
+			val.ProcessAverageCPU, val.ProcessMaxCPU, val.SystemAverageCPU, val.SystemMaxCPU)
+		if err != nil {
+			continue
+		}
+		if !charted {
+			session.StartTime, session.SamplingInterval = val.StartTime, val.SamplingInterval
+			charted = true
+		}
+		session.EndTime = val.EndTime
+
+		session.ProcessAverageCPU = appendSamples(session.ProcessAverageCPU, timestamp, val.ProcessAverageCPU)
+		session.ProcessMaxCPU = appendSamples(session.ProcessMaxCPU, timestamp, val.ProcessMaxCPU)
+		session.SystemAverageCPU = appendSamples(session.SystemAverageCPU, timestamp, val.SystemAverageCPU)
+		session.SystemMaxCPU = appendSamples(session.SystemMaxCPU, timestamp, val.SystemMaxCPU)
+	}
+
+	return session, charted
+}
+
+// sampleTimes returns the time of the i-th sample of an interval of the given series.
+// The samples are samplingInterval apart from startTime, without an interval they are spread evenly until endTime.
+// Both times must parse, so the interval lies within the meeting.
+func sampleTimes(startTime, endTime string, samplingInterval int, series ...[]float32) (func(i int) time.Time, error) {
+	start, err := time.Parse(time.RFC3339, startTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quality data, bad start time %q", startTime)
+	}
+	end, err := time.Parse(time.RFC3339, endTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid quality data, bad end time %q", endTime)
+	}
+
+	step := time.Duration(samplingInterval) * time.Second
+	if step <= 0 {
+		n := 0
+		for _, values := range series {
+			if len(values) > n {
+				n = len(values)
+			}
+		}
+		if n > 0 {
+			step = end.Sub(start) / time.Duration(n)
+		}
+	}
+
+	return func(i int) time.Time {
+		return start.Add(time.Duration(i) * step)
+	}, nil
+}
+
+func appendSamples(samples []Sample, timestamp func(i int) time.Time, values []float32) []Sample {
+	for i, value := range values {
+		samples = append(samples, Sample{Time: timestamp(i), Value: value})
 	}
+	return samples
 }
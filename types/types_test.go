@@ -0,0 +1,372 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// PROPERTY_RUNS is the number of random meeting qualities every property is checked against.
+const PROPERTY_RUNS = 300
+
+// fakeQualities generates the meeting qualities of up to 6 media sessions, any of their streams may be missing.
+// Participants may join several times, and have no participant ID or email.
+func fakeQualities(f *gofakeit.Faker) *MeetingQualities {
+	start := f.DateRange(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)).Truncate(time.Second)
+	qualities := &MeetingQualities{MeetingID: f.UUID()}
+
+	var joined []MediaSessionQuality
+	for i, n := 0, f.Number(0, 6); i < n; i++ {
+		session := MediaSessionQuality{
+			MeetingID:     qualities.MeetingID,
+			DisplayName:   f.Name(),
+			Email:         f.RandomString([]string{"", f.Email()}),
+			ParticipantID: f.RandomString([]string{"", f.UUID()}),
+		}
+		// a participant joining again
+		if len(joined) > 0 && f.Number(1, 4) == 1 {
+			previous := joined[f.Number(0, len(joined)-1)]
+			session.DisplayName, session.Email, session.ParticipantID = previous.DisplayName, previous.Email, previous.ParticipantID
+		}
+		joined = append(joined, session)
+
+		from := start.Add(time.Duration(f.Number(0, 600)) * time.Second)
+		streams := []*[]MediaQualityData{&session.VideoIn, &session.VideoOut, &session.AudioIn, &session.AudioOut, &session.ShareIn, &session.ShareOut}
+		for _, stream := range streams {
+			if f.Bool() {
+				*stream = fakeStream(f, from)
+			}
+		}
+		if f.Bool() {
+			session.Resources = fakeResources(f, from)
+		}
+
+		qualities.MediaSessions = append(qualities.MediaSessions, session)
+	}
+
+	return qualities
+}
+
+// fakeStream generates up to 4 intervals of quality data from start, with gaps between them.
+// Their sampling interval may be unknown, the samples are then spread over the interval.
+func fakeStream(f *gofakeit.Faker, start time.Time) []MediaQualityData {
+	var stream []MediaQualityData
+	for i, n := 0, f.Number(0, 4); i < n; i++ {
+		data := MediaQualityData{SamplingInterval: f.RandomInt([]int{0, 1, 30, 60})}
+		samples := f.Number(0, 10)
+		data.StartTime, data.EndTime, start = interval(f, start, data.SamplingInterval, samples)
+
+		for j := 0; j < samples; j++ {
+			data.PacketLoss = append(data.PacketLoss, f.Float32Range(0, 100))
+			data.Latency = append(data.Latency, f.Float32Range(0, 1000))
+			data.Jitter = append(data.Jitter, f.Float32Range(0, 100))
+			data.MediaBitRate = append(data.MediaBitRate, f.Float32Range(0, 4000000))
+		}
+		if f.Bool() {
+			data.ResolutionHeight = make([]float32, samples)
+			data.FrameRate = make([]float32, samples)
+		}
+		data.Codec = f.RandomString([]string{"", "opus", "H.264", "AV1"})
+		data.TransportType = f.RandomString([]string{"", "UDP", "TCP"})
+
+		stream = append(stream, data)
+	}
+
+	return stream
+}
+
+// fakeResources generates up to 4 intervals of CPU usage from start, with gaps between them.
+func fakeResources(f *gofakeit.Faker, start time.Time) []Resources {
+	var resources []Resources
+	for i, n := 0, f.Number(0, 4); i < n; i++ {
+		r := Resources{SamplingInterval: f.RandomInt([]int{0, 60})}
+		samples := f.Number(0, 10)
+		r.StartTime, r.EndTime, start = interval(f, start, r.SamplingInterval, samples)
+
+		for j := 0; j < samples; j++ {
+			r.ProcessAverageCPU = append(r.ProcessAverageCPU, f.Float32Range(0, 100))
+			r.ProcessMaxCPU = append(r.ProcessMaxCPU, f.Float32Range(0, 100))
+			r.SystemAverageCPU = append(r.SystemAverageCPU, f.Float32Range(0, 100))
+			r.SystemMaxCPU = append(r.SystemMaxCPU, f.Float32Range(0, 100))
+		}
+		resources = append(resources, r)
+	}
+
+	return resources
+}
+
+// interval returns the start and end time of an interval of samples after a gap from start, and the start of the next.
+// Either time may be missing or malformed, as Webex sometimes reports them.
+func interval(f *gofakeit.Faker, start time.Time, samplingInterval, samples int) (string, string, time.Time) {
+	from := start.Add(time.Duration(f.Number(0, 300)) * time.Second)
+	length := time.Duration(samplingInterval*samples) * time.Second
+	if samplingInterval == 0 {
+		length = time.Duration(f.Number(0, 600)) * time.Second
+	}
+	to := from.Add(length)
+
+	return fakeTime(f, from), fakeTime(f, to), to
+}
+
+// fakeTime formats at in RFC 3339 most of the time, it is otherwise empty or malformed.
+func fakeTime(f *gofakeit.Faker, at time.Time) string {
+	switch f.Number(1, 20) {
+	case 1:
+		return ""
+	case 2:
+		return f.RandomString([]string{"yesterday", "2022-13-45T25:61:00Z", at.Format(time.RFC1123), at.Format("2006-01-02 15:04:05")})
+	default:
+		return at.Format(time.RFC3339)
+	}
+}
+
+// charted tells whether the interval has both times, only such intervals are charted.
+func charted(startTime, endTime string) bool {
+	_, startErr := time.Parse(time.RFC3339, startTime)
+	_, endErr := time.Parse(time.RFC3339, endTime)
+	return startErr == nil && endErr == nil
+}
+
+// forAll checks the property against random meeting qualities, the seed of a failing run reproduces it.
+func forAll(t *testing.T, property func(t *testing.T, qualities *MeetingQualities)) {
+	t.Helper()
+
+	for seed := int64(1); seed <= PROPERTY_RUNS; seed++ {
+		qualities := fakeQualities(gofakeit.New(seed))
+		property(t, qualities)
+		if t.Failed() {
+			data, _ := json.Marshal(qualities)
+			t.Fatalf("seed %d: %s", seed, data)
+		}
+	}
+}
+
+// samplesOf counts the samples of all the series of the data point of the session, in the intervals that are charted.
+func samplesOf(session MediaSessionQuality, dp string) int {
+	var n int
+	count := func(series ...[]float32) {
+		for _, values := range series {
+			n += len(values)
+		}
+	}
+
+	streams := map[string][]MediaQualityData{
+		"video_in": session.VideoIn, "video_out": session.VideoOut,
+		"audio_in": session.AudioIn, "audio_out": session.AudioOut,
+		"share_in": session.ShareIn, "share_out": session.ShareOut,
+	}
+	for _, data := range streams[dp] {
+		if !charted(data.StartTime, data.EndTime) {
+			continue
+		}
+		count(data.PacketLoss, data.Latency, data.Jitter, data.MediaBitRate, data.ResolutionHeight, data.FrameRate)
+	}
+	if dp == "resources" {
+		for _, r := range session.Resources {
+			if !charted(r.StartTime, r.EndTime) {
+				continue
+			}
+			count(r.ProcessAverageCPU, r.ProcessMaxCPU, r.SystemAverageCPU, r.SystemMaxCPU)
+		}
+	}
+	return n
+}
+
+// seriesOf returns all the series of the session data.
+func seriesOf(session SessionData) [][]Sample {
+	return [][]Sample{session.PacketLoss, session.Latency, session.Jitter, session.MediaBitRate, session.ResolutionHeight, session.FrameRate,
+		session.ProcessAverageCPU, session.ProcessMaxCPU, session.SystemAverageCPU, session.SystemMaxCPU}
+}
+
+func TestGetVisualDataKeepsEverySample(t *testing.T) {
+	forAll(t, func(t *testing.T, qualities *MeetingQualities) {
+		for _, dp := range DATA_POINTS {
+			visualData, err := GetVisualData(qualities, dp)
+			if err != nil {
+				t.Errorf("%s: %v", dp, err)
+				return
+			}
+
+			// every sample of the participant's sessions is charted, in the participant's own sessions
+			want := map[string]int{}
+			for _, session := range qualities.MediaSessions {
+				want[participantKey(session)] += samplesOf(session, dp)
+			}
+			got := map[string]int{}
+			for _, participant := range visualData.Participants {
+				if _, ok := got[participant.Key]; ok {
+					t.Errorf("%s: participant %q is listed twice", dp, participant.Key)
+				}
+				got[participant.Key] = 0
+				for _, session := range participant.Sessions {
+					for _, series := range seriesOf(session) {
+						got[participant.Key] += len(series)
+					}
+				}
+			}
+			for key, n := range want {
+				if got[key] != n {
+					t.Errorf("%s: want %d samples of %q, got %d", dp, n, key, got[key])
+				}
+			}
+		}
+	})
+}
+
+func TestGetVisualDataSamplesWithinMeeting(t *testing.T) {
+	forAll(t, func(t *testing.T, qualities *MeetingQualities) {
+		for _, dp := range DATA_POINTS {
+			visualData, err := GetVisualData(qualities, dp)
+			if err != nil {
+				t.Errorf("%s: %v", dp, err)
+				return
+			}
+			if len(visualData.Participants) == 0 {
+				continue
+			}
+
+			start, err := time.Parse(time.RFC3339, visualData.StartTime)
+			if err != nil {
+				t.Errorf("%s: want a start time, got %q", dp, visualData.StartTime)
+				return
+			}
+			end, err := time.Parse(time.RFC3339, visualData.EndTime)
+			if err != nil {
+				t.Errorf("%s: want an end time, got %q", dp, visualData.EndTime)
+				return
+			}
+
+			// the samples of a series are in order, from the start until the end of the meeting
+			for _, participant := range visualData.Participants {
+				for _, session := range participant.Sessions {
+					for _, series := range seriesOf(session) {
+						for i, sample := range series {
+							if sample.Time.Before(start) || sample.Time.After(end) {
+								t.Errorf("%s: sample at %s outside the meeting, from %s to %s", dp, sample.Time, start, end)
+							}
+							if i > 0 && sample.Time.Before(series[i-1].Time) {
+								t.Errorf("%s: sample at %s after the one at %s", dp, series[i-1].Time, sample.Time)
+							}
+						}
+					}
+				}
+			}
+		}
+	})
+}
+
+func TestGetVisualDataMeetingTimes(t *testing.T) {
+	forAll(t, func(t *testing.T, qualities *MeetingQualities) {
+		visualData, err := GetVisualData(qualities, "audio_in")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		// the meeting spans every stream, whichever the data point
+		for _, session := range qualities.MediaSessions {
+			// the intervals that are not charted are ignored
+			var times []string
+			span := func(startTime, endTime string) {
+				if charted(startTime, endTime) {
+					times = append(times, startTime, endTime)
+				}
+			}
+			for _, stream := range [][]MediaQualityData{session.VideoIn, session.VideoOut, session.AudioIn, session.AudioOut, session.ShareIn, session.ShareOut} {
+				for _, data := range stream {
+					span(data.StartTime, data.EndTime)
+				}
+			}
+			for _, r := range session.Resources {
+				span(r.StartTime, r.EndTime)
+			}
+
+			for _, at := range times {
+				if at < visualData.StartTime || at > visualData.EndTime {
+					t.Errorf("%s is outside the meeting, from %s to %s", at, visualData.StartTime, visualData.EndTime)
+				}
+			}
+		}
+	})
+}
+
+func TestGetAllVisualData(t *testing.T) {
+	forAll(t, func(t *testing.T, qualities *MeetingQualities) {
+		all, err := GetAllVisualData(qualities)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if len(all) != len(DATA_POINTS) {
+			t.Errorf("want %d data points, got %d", len(DATA_POINTS), len(all))
+			return
+		}
+		for i, visualData := range all {
+			if visualData.DataPoint != DATA_POINTS[i] || visualData.MeetingID != qualities.MeetingID {
+				t.Errorf("want %s of %s, got %s of %s", DATA_POINTS[i], qualities.MeetingID, visualData.DataPoint, visualData.MeetingID)
+			}
+		}
+	})
+}
+
+func TestGetVisualDataEmptyMeeting(t *testing.T) {
+	for _, qualities := range []*MeetingQualities{
+		{MeetingID: "meeting"},
+		{MeetingID: "meeting", MediaSessions: []MediaSessionQuality{{ParticipantID: "phone"}}},
+	} {
+		all, err := GetAllVisualData(qualities)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, visualData := range all {
+			if visualData.Participants == nil || len(visualData.Participants) != 0 || visualData.StartTime != "" || visualData.EndTime != "" {
+				t.Errorf("%s: want no participants nor times, got %+v", visualData.DataPoint, visualData)
+			}
+		}
+	}
+}
+
+func TestGetVisualDataSkipsUnreadableIntervals(t *testing.T) {
+	qualities := &MeetingQualities{MeetingID: "meeting", MediaSessions: []MediaSessionQuality{
+		{ParticipantID: "alice", AudioIn: []MediaQualityData{
+			{StartTime: "yesterday", EndTime: "2022-01-01T10:01:00Z", SamplingInterval: 60, PacketLoss: []float32{1}},
+			{StartTime: "2022-01-01T10:01:00Z", EndTime: "2022-01-01T10:02:00Z", SamplingInterval: 60, PacketLoss: []float32{2}},
+			{StartTime: "2022-01-01T10:02:00Z", EndTime: "", SamplingInterval: 60, PacketLoss: []float32{3}},
+		}},
+		{ParticipantID: "bob", AudioIn: []MediaQualityData{
+			{StartTime: "", EndTime: "", PacketLoss: []float32{4}},
+		}},
+	}}
+
+	visualData, err := GetVisualData(qualities, "audio_in")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bob has no interval left, alice only the one with both times
+	if len(visualData.Participants) != 1 || len(visualData.Participants[0].Sessions) != 1 {
+		t.Fatalf("want only the session of alice, got %+v", visualData.Participants)
+	}
+	session := visualData.Participants[0].Sessions[0]
+	if len(session.PacketLoss) != 1 || session.PacketLoss[0].Value != 2 {
+		t.Errorf("want only the sample of the readable interval, got %+v", session.PacketLoss)
+	}
+	if session.StartTime != "2022-01-01T10:01:00Z" || session.EndTime != "2022-01-01T10:02:00Z" {
+		t.Errorf("want the session to span the readable interval, got %s to %s", session.StartTime, session.EndTime)
+	}
+}
+
+func TestGetVisualDataErrors(t *testing.T) {
+	if _, err := GetVisualData(nil, "audio_in"); err != ErrNoQualities {
+		t.Errorf("want ErrNoQualities, got %v", err)
+	}
+	if _, err := GetAllVisualData(nil); err != ErrNoQualities {
+		t.Errorf("want ErrNoQualities, got %v", err)
+	}
+
+	// the data point is checked even without media sessions
+	if _, err := GetVisualData(&MeetingQualities{MeetingID: "meeting"}, "smell_in"); err == nil {
+		t.Errorf("want an error for an unknown data point")
+	}
+}
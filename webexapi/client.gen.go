@@ -0,0 +1,309 @@
+// Code generated by webexapi/gen from api/openapi.json. DO NOT EDIT.
+
+package webexapi
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// ErrorResponse is the ErrorResponse schema of the API.
+type ErrorResponse struct {
+	Message string `json:"message"`
+	// HTTP status code of the response.
+	Status int `json:"status"`
+	// Identifies the request at Webex when the error comes from Webex.
+	TrackingID string `json:"tracking_id,omitempty"`
+}
+
+// MediaChange is the MediaChange schema of the API.
+// The codec and transport a media session used from time on.
+type MediaChange struct {
+	Codec         string    `json:"codec"`
+	Time          time.Time `json:"time"`
+	TransportType string    `json:"transport_type"`
+}
+
+// MediaQualityData is the MediaQualityData schema of the API.
+type MediaQualityData struct {
+	Codec            string    `json:"codec,omitempty"`
+	EndTime          string    `json:"endTime,omitempty"`
+	FrameRate        []float32 `json:"frameRate,omitempty"`
+	Jitter           []float32 `json:"jitter,omitempty"`
+	Latency          []float32 `json:"latency,omitempty"`
+	MediaBitRate     []float32 `json:"mediaBitRate,omitempty"`
+	PacketLoss       []float32 `json:"packetLoss,omitempty"`
+	ResolutionHeight []float32 `json:"resolutionHeight,omitempty"`
+	// Seconds between two samples.
+	SamplingInterval int    `json:"samplingInterval,omitempty"`
+	StartTime        string `json:"startTime,omitempty"`
+	TransportType    string `json:"transportType,omitempty"`
+}
+
+// MediaSessionQuality is the MediaSessionQuality schema of the API.
+type MediaSessionQuality struct {
+	// Downstream audio quality.
+	AudioIn []MediaQualityData `json:"audioIn,omitempty"`
+	// Upstream audio quality.
+	AudioOut       []MediaQualityData `json:"audioOut,omitempty"`
+	Camera         string             `json:"camera,omitempty"`
+	Client         string             `json:"client,omitempty"`
+	ClientVersion  string             `json:"clientVersion,omitempty"`
+	DisplayName    string             `json:"displayName,omitempty"`
+	Email          string             `json:"email,omitempty"`
+	HardwareType   string             `json:"hardwareType,omitempty"`
+	Joined         string             `json:"joined,omitempty"`
+	LocalIP        string             `json:"localIP,omitempty"`
+	MaskedLocalIP  string             `json:"maskedLocalIP,omitempty"`
+	MaskedPublicIP string             `json:"maskedPublicIP,omitempty"`
+	MeetingID      string             `json:"meetingId,omitempty"`
+	Microphone     string             `json:"microphone,omitempty"`
+	NetworkType    string             `json:"networkType,omitempty"`
+	OsType         string             `json:"osType,omitempty"`
+	OsVersion      string             `json:"osVersion,omitempty"`
+	ParticipantID  string             `json:"participantId,omitempty"`
+	PublicIP       string             `json:"publicIP,omitempty"`
+	// Device resources such as CPU.
+	Resources    []Resources `json:"resources,omitempty"`
+	ServerRegion string      `json:"serverRegion,omitempty"`
+	// Downstream share quality.
+	ShareIn []MediaQualityData `json:"shareIn,omitempty"`
+	// Upstream share quality.
+	ShareOut    []MediaQualityData `json:"shareOut,omitempty"`
+	SpeakerName string             `json:"speakerName,omitempty"`
+	// Downstream video quality, sent to the client.
+	VideoIn          []MediaQualityData `json:"videoIn,omitempty"`
+	VideoMeshCluster string             `json:"videoMeshCluster,omitempty"`
+	// Upstream video quality, sent from the client.
+	VideoOut []MediaQualityData `json:"videoOut,omitempty"`
+}
+
+// MeetingQualities is the MeetingQualities schema of the API.
+type MeetingQualities struct {
+	// One media session per participant and device.
+	Items     []MediaSessionQuality `json:"items"`
+	MeetingID string                `json:"meeting_id"`
+}
+
+// MeetingSeries is the MeetingSeries schema of the API.
+type MeetingSeries struct {
+	Agenda                       string `json:"agenda,omitempty"`
+	AllowAuthenticatedDevices    bool   `json:"allowAuthenticatedDevices,omitempty"`
+	AllowFirstUserToBeCoHost     bool   `json:"allowFirstUserToBeCoHost,omitempty"`
+	AllowUserToBeCoHost          bool   `json:"allowUserToBeCoHost,omitempty"`
+	AutomaticLockMinutes         int    `json:"automaticLockMinutes,omitempty"`
+	DialInIPAddress              string `json:"dialInIpAddress,omitempty"`
+	EnableAutoRecordMeeting      bool   `json:"enableAutoRecordMeeting,omitempty"`
+	EnableAutomaticLock          bool   `json:"enableAutomaticLock,omitempty"`
+	EnableConnectAudioBeforeHost bool   `json:"enableConnectAudioBeforeHost,omitempty"`
+	EnabledJoinBeforeHost        bool   `json:"enabledJoinBeforeHost,omitempty"`
+	EnabledWebcastView           bool   `json:"enabledWebcastView,omitempty"`
+	// End of the meeting, an RFC 3339 timestamp.
+	End                                 string                 `json:"end"`
+	ExcludePassword                     bool                   `json:"excludePassword,omitempty"`
+	HostDisplayName                     string                 `json:"hostDisplayName,omitempty"`
+	HostEmail                           string                 `json:"hostEmail,omitempty"`
+	HostKey                             string                 `json:"hostKey,omitempty"`
+	HostUserID                          string                 `json:"hostUserId,omitempty"`
+	ID                                  string                 `json:"id"`
+	IntegrationTags                     []string               `json:"integrationTags,omitempty"`
+	JoinBeforeHostMinutes               int                    `json:"joinBeforeHostMinutes,omitempty"`
+	MeetingNumber                       string                 `json:"meetingNumber,omitempty"`
+	MeetingType                         string                 `json:"meetingType,omitempty"`
+	PanelistPassword                    string                 `json:"panelistPassword,omitempty"`
+	Password                            string                 `json:"password,omitempty"`
+	PhoneAndVideoSystemPanelistPassword string                 `json:"phoneAndVideoSystemPanelistPassword,omitempty"`
+	PhoneAndVideoSystemPassword         string                 `json:"phoneAndVideoSystemPassword,omitempty"`
+	PublicMeeting                       bool                   `json:"publicMeeting,omitempty"`
+	Recurrence                          string                 `json:"recurrence,omitempty"`
+	Registration                        map[string]interface{} `json:"registration,omitempty"`
+	ReminderTime                        int                    `json:"reminderTime,omitempty"`
+	RoomID                              string                 `json:"roomId,omitempty"`
+	ScheduledType                       string                 `json:"scheduledType,omitempty"`
+	SessionTypeID                       int                    `json:"sessionTypeId,omitempty"`
+	SipAddress                          string                 `json:"sipAddress,omitempty"`
+	SiteURL                             string                 `json:"siteUrl,omitempty"`
+	// Start of the meeting, an RFC 3339 timestamp.
+	Start                       string                 `json:"start"`
+	State                       string                 `json:"state,omitempty"`
+	Telephony                   map[string]interface{} `json:"telephony,omitempty"`
+	Timezone                    string                 `json:"timezone,omitempty"`
+	Title                       string                 `json:"title"`
+	UnlockedMeetingJoinSecurity string                 `json:"unlockedMeetingJoinSecurity,omitempty"`
+	WebLink                     string                 `json:"webLink,omitempty"`
+}
+
+// MeetingsList is the MeetingsList schema of the API.
+type MeetingsList struct {
+	Items []MeetingSeries `json:"items"`
+}
+
+// ParticipantData is the ParticipantData schema of the API.
+type ParticipantData struct {
+	DisplayName string `json:"display_name"`
+	Email       string `json:"email"`
+	// The participant ID, else the email, else the display name.
+	Key string `json:"key"`
+	// One entry per media session, e.g. when the participant joined again.
+	Sessions []SessionData `json:"sessions"`
+}
+
+// Resources is the Resources schema of the API.
+type Resources struct {
+	EndTime           string    `json:"endTime,omitempty"`
+	ProcessAverageCPU []float32 `json:"processAverageCPU,omitempty"`
+	ProcessMaxCPU     []float32 `json:"processMaxCPU,omitempty"`
+	SamplingInterval  int       `json:"samplingInterval,omitempty"`
+	StartTime         string    `json:"startTime,omitempty"`
+	SystemAverageCPU  []float32 `json:"systemAverageCPU,omitempty"`
+	SystemMaxCPU      []float32 `json:"systemMaxCPU,omitempty"`
+}
+
+// Sample is the Sample schema of the API.
+// A value of a series and the time it was sampled at.
+type Sample struct {
+	Time  time.Time `json:"time"`
+	Value float32   `json:"value"`
+}
+
+// SessionData is the SessionData schema of the API.
+type SessionData struct {
+	// The codec and transport of the session from its start, then every time either changed.
+	Changes []MediaChange `json:"changes,omitempty"`
+	EndTime string        `json:"end_time"`
+	// Only sampled for video and share.
+	FrameRate    []Sample `json:"frame_rate,omitempty"`
+	Jitter       []Sample `json:"jitter,omitempty"`
+	Latency      []Sample `json:"latency,omitempty"`
+	MediaBitRate []Sample `json:"media_bit_rate,omitempty"`
+	PacketLoss   []Sample `json:"packet_loss,omitempty"`
+	// CPU usage in percent, only sampled for the resources data point.
+	ProcessAverageCPU []Sample `json:"process_average_cpu,omitempty"`
+	// CPU usage in percent, only sampled for the resources data point.
+	ProcessMaxCPU []Sample `json:"process_max_cpu,omitempty"`
+	// Only sampled for video and share.
+	ResolutionHeight []Sample `json:"resolution_height,omitempty"`
+	// Time between two samples in seconds.
+	SamplingInterval int    `json:"sampling_interval"`
+	StartTime        string `json:"start_time"`
+	// CPU usage in percent, only sampled for the resources data point.
+	SystemAverageCPU []Sample `json:"system_average_cpu,omitempty"`
+	// CPU usage in percent, only sampled for the resources data point.
+	SystemMaxCPU []Sample `json:"system_max_cpu,omitempty"`
+}
+
+// VisualData is the VisualData schema of the API.
+type VisualData struct {
+	DataPoint string `json:"data_point"`
+	EndTime   string `json:"end_time"`
+	MeetingID string `json:"meeting_id"`
+	// The participants in the order they first appear in the meeting qualities.
+	Participants []ParticipantData `json:"participants"`
+	StartTime    string            `json:"start_time"`
+}
+
+// GetOpenAPI calls GET /api/openapi.json.
+func (c *Client) GetOpenAPI(ctx context.Context) (map[string]interface{}, error) {
+	query := url.Values{}
+
+	var result map[string]interface{}
+	if err := c.get(ctx, "/api/openapi.json", query, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ListMeetingsParams are the query parameters of ListMeetings, the nil ones are not sent.
+type ListMeetingsParams struct {
+	// Start of the period, an RFC 3339 timestamp, a datetime-local value or a date. Without to, the period spans 30 days from it.
+	From *string
+	// End of the period, in the format of from. Without from, the period spans the 30 days before it.
+	To *string
+	// One of "", "meeting", "scheduledMeeting", "meetingSeries".
+	MeetingType *string
+	// One of "", "active", "scheduled", "ready", "lobby", "inProgress", "ended", "missed", "expired".
+	State         *string
+	HostEmail     *string
+	SiteURL       *string
+	MeetingNumber *string
+	WebLink       *string
+	// Size of the pages requested to Webex.
+	Max *int
+}
+
+// ListMeetings calls GET /api/v1/meetings.
+// Lists every page of the meetings matching the filters, the last 30 days by default.
+func (c *Client) ListMeetings(ctx context.Context, params *ListMeetingsParams) (*MeetingsList, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.From != nil {
+			query.Set("from", *params.From)
+		}
+		if params.To != nil {
+			query.Set("to", *params.To)
+		}
+		if params.MeetingType != nil {
+			query.Set("meetingType", *params.MeetingType)
+		}
+		if params.State != nil {
+			query.Set("state", *params.State)
+		}
+		if params.HostEmail != nil {
+			query.Set("hostEmail", *params.HostEmail)
+		}
+		if params.SiteURL != nil {
+			query.Set("siteUrl", *params.SiteURL)
+		}
+		if params.MeetingNumber != nil {
+			query.Set("meetingNumber", *params.MeetingNumber)
+		}
+		if params.WebLink != nil {
+			query.Set("webLink", *params.WebLink)
+		}
+		if params.Max != nil {
+			query.Set("max", strconv.Itoa(*params.Max))
+		}
+	}
+
+	var result MeetingsList
+	if err := c.get(ctx, "/api/v1/meetings", query, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetMeetingQualities calls GET /api/v1/meetings/{id}/qualities.
+// The media quality of every participant of the meeting.
+func (c *Client) GetMeetingQualities(ctx context.Context, id string) (*MeetingQualities, error) {
+	query := url.Values{}
+
+	var result MeetingQualities
+	if err := c.get(ctx, "/api/v1/meetings/"+url.PathEscape(id)+"/qualities", query, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// GetVisualDataParams are the query parameters of GetVisualData, the nil ones are not sent.
+type GetVisualDataParams struct {
+	// The data point, audio_in by default, or resources for the CPU usage of the devices. One of "audio_in", "audio_out", "video_in", "video_out", "share_in", "share_out", "resources".
+	Dp *string
+}
+
+// GetVisualData calls GET /api/v1/meetings/{id}/visual.
+func (c *Client) GetVisualData(ctx context.Context, id string, params *GetVisualDataParams) (*VisualData, error) {
+	query := url.Values{}
+	if params != nil {
+		if params.Dp != nil {
+			query.Set("dp", *params.Dp)
+		}
+	}
+
+	var result VisualData
+	if err := c.get(ctx, "/api/v1/meetings/"+url.PathEscape(id)+"/visual", query, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,88 @@
+// Package webexapi is a Go client of the JSON API of the server, generated from api/openapi.json.
+//
+// The operations and the types are generated in client.gen.go, run go generate after changing the document.
+// A client authenticates with a personal access token or with the session cookie held by the jar of its HTTP client:
+//
+//	client := webexapi.NewClient("https://example.com")
+//	client.Token = os.Getenv("WEBEX_APP_TOKEN")
+//	meetings, err := client.ListMeetings(ctx, nil)
+package webexapi
+
+//go:generate go run ./gen -spec ../api/openapi.json -out client.gen.go
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client calls the JSON API of a server.
+type Client struct {
+	// Server is the root URL of the server, e.g. https://example.com.
+	Server string
+	// HTTPClient sends the requests, http.DefaultClient when nil. Its jar holds the session cookie, if any.
+	HTTPClient *http.Client
+	// Token is a personal access token created on the settings page, sent as a bearer token when set.
+	Token string
+}
+
+// NewClient returns a client of the server, server is its root URL.
+func NewClient(server string) *Client {
+	return &Client{Server: strings.TrimSuffix(server, "/")}
+}
+
+// Error is a response of the server other than 200, with its ErrorResponse body.
+type Error struct {
+	StatusCode int
+	ErrorResponse
+	// RetryAfter is how long to wait before trying again when the Webex rate limit is reached.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("webexapi: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// get sends a GET request for the path and decodes the JSON body of the 200 response into result.
+func (c *Client) get(ctx context.Context, path string, query url.Values, result interface{}) error {
+	u := c.Server + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&apiErr.ErrorResponse); err != nil {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return apiErr
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,31 @@
+package webexapi
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"Webex.API.Integration.And.Visualization/webexapi/internal/codegen"
+)
+
+// TestClientIsUpToDate checks client.gen.go was generated from the current OpenAPI document.
+func TestClientIsUpToDate(t *testing.T) {
+	doc, err := openapi3.NewLoader().LoadFromFile("../api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := codegen.Generate(doc, "webexapi", "api/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := os.ReadFile("client.gen.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("client.gen.go is out of date with api/openapi.json, run go generate ./webexapi")
+	}
+}
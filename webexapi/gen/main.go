@@ -0,0 +1,35 @@
+// Command gen generates the client of the webexapi package from the OpenAPI document of the JSON API.
+//
+//	go run ./gen -spec ../api/openapi.json -out client.gen.go
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"Webex.API.Integration.And.Visualization/webexapi/internal/codegen"
+)
+
+func main() {
+	spec := flag.String("spec", "../api/openapi.json", "the OpenAPI document")
+	out := flag.String("out", "client.gen.go", "the generated file")
+	pkg := flag.String("package", "webexapi", "the package of the generated file")
+	flag.Parse()
+
+	doc, err := openapi3.NewLoader().LoadFromFile(*spec)
+	if err != nil {
+		log.Fatalf("error loading %s: %s\n", *spec, err.Error())
+	}
+
+	src, err := codegen.Generate(doc, *pkg, "api/"+filepath.Base(*spec))
+	if err != nil {
+		log.Fatalf("error generating the client: %s\n", err.Error())
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		log.Fatalf("error writing %s: %s\n", *out, err.Error())
+	}
+}
@@ -0,0 +1,331 @@
+// Package codegen generates the Go client of the JSON API from its OpenAPI 3 document.
+//
+// Only what the document uses is supported: GET operations with path and query parameters, JSON responses
+// and object schemas made of strings, numbers, booleans, arrays and references.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// initialisms are written upper case in the Go names, e.g. meeting_id is MeetingID.
+var initialisms = map[string]bool{"Api": true, "Cpu": true, "Id": true, "Ip": true, "Url": true}
+
+// Generate writes the types of the component schemas of the document and a Client method per operation.
+// The source names the document in the header of the generated file.
+func Generate(doc *openapi3.T, pkg, source string) ([]byte, error) {
+	g := &generator{imports: map[string]bool{}}
+
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := g.schema(name, doc.Components.Schemas[name]); err != nil {
+			return nil, fmt.Errorf("schema %s: %w", name, err)
+		}
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		operations := doc.Paths[path].Operations()
+		methods := make([]string, 0, len(operations))
+		for method := range operations {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			if err := g.operation(method, path, operations[method]); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", method, path, err)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by webexapi/gen from %s. DO NOT EDIT.\n\npackage %s\n\n", source, pkg)
+	if len(g.imports) > 0 {
+		imports := make([]string, 0, len(g.imports))
+		for path := range g.imports {
+			imports = append(imports, path)
+		}
+		sort.Strings(imports)
+		out.WriteString("import (\n")
+		for _, path := range imports {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(g.body.Bytes())
+
+	return format.Source(out.Bytes())
+}
+
+type generator struct {
+	body    bytes.Buffer
+	imports map[string]bool
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+// schema writes the struct of an object schema, its optional properties are omitted when empty.
+func (g *generator) schema(name string, ref *openapi3.SchemaRef) error {
+	schema := ref.Value
+	if schema.Type != "object" || len(schema.Properties) == 0 {
+		return fmt.Errorf("only object schemas with properties are supported")
+	}
+
+	g.printf("// %s is the %s schema of the API.\n", goName(name), name)
+	comment(&g.body, "", schema.Description)
+	g.printf("type %s struct {\n", goName(name))
+
+	properties := make([]string, 0, len(schema.Properties))
+	for property := range schema.Properties {
+		properties = append(properties, property)
+	}
+	sort.Strings(properties)
+	for _, property := range properties {
+		typ, err := g.goType(schema.Properties[property])
+		if err != nil {
+			return fmt.Errorf("property %s: %w", property, err)
+		}
+
+		tag := property
+		if !contains(schema.Required, property) {
+			tag += ",omitempty"
+		}
+		comment(&g.body, "\t", schema.Properties[property].Value.Description)
+		g.printf("\t%s %s `json:\"%s\"`\n", goName(property), typ, tag)
+	}
+	g.printf("}\n\n")
+	return nil
+}
+
+// goType is the Go type of a schema, a reference is the type of the component schema.
+func (g *generator) goType(ref *openapi3.SchemaRef) (string, error) {
+	if ref.Ref != "" {
+		return goName(ref.Ref[strings.LastIndex(ref.Ref, "/")+1:]), nil
+	}
+
+	schema := ref.Value
+	switch schema.Type {
+	case "string":
+		if schema.Format == "date-time" {
+			g.imports["time"] = true
+			return "time.Time", nil
+		}
+		return "string", nil
+	case "integer":
+		return "int", nil
+	case "number":
+		if schema.Format == "float" {
+			return "float32", nil
+		}
+		return "float64", nil
+	case "boolean":
+		return "bool", nil
+	case "array":
+		items, err := g.goType(schema.Items)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + items, nil
+	case "object":
+		if len(schema.Properties) == 0 {
+			return "map[string]interface{}", nil
+		}
+		return "", fmt.Errorf("inline object schemas are not supported, use a component schema")
+	}
+	return "", fmt.Errorf("unsupported type %q", schema.Type)
+}
+
+// operation writes the Client method of the operation, and the struct of its query parameters if it has some.
+// The method returns the JSON body of the 200 response, any other response is returned as an *Error.
+func (g *generator) operation(method, path string, operation *openapi3.Operation) error {
+	if method != "GET" || operation.RequestBody != nil {
+		return fmt.Errorf("only GET operations without a request body are supported")
+	}
+	if operation.OperationID == "" {
+		return fmt.Errorf("the operation has no operationId")
+	}
+	name := goName(operation.OperationID)
+
+	ok := operation.Responses.Get(200)
+	if ok == nil || ok.Value.Content.Get("application/json") == nil {
+		return fmt.Errorf("the operation has no JSON 200 response")
+	}
+	result, err := g.goType(ok.Value.Content.Get("application/json").Schema)
+	if err != nil {
+		return fmt.Errorf("200 response: %w", err)
+	}
+
+	var pathParams, queryParams []*openapi3.Parameter
+	for _, ref := range operation.Parameters {
+		switch ref.Value.In {
+		case openapi3.ParameterInPath:
+			pathParams = append(pathParams, ref.Value)
+		case openapi3.ParameterInQuery:
+			queryParams = append(queryParams, ref.Value)
+		default:
+			return fmt.Errorf("parameter %s: only path and query parameters are supported", ref.Value.Name)
+		}
+	}
+
+	if len(queryParams) > 0 {
+		g.printf("// %sParams are the query parameters of %s, the nil ones are not sent.\n", name, name)
+		g.printf("type %sParams struct {\n", name)
+		for _, param := range queryParams {
+			typ, err := paramType(param)
+			if err != nil {
+				return err
+			}
+			comment(&g.body, "\t", param.Description+enumValues(param.Schema.Value.Enum))
+			g.printf("\t%s *%s\n", goName(param.Name), typ)
+		}
+		g.printf("}\n\n")
+	}
+
+	// the path parameters are arguments, in the order of the path
+	args := []string{"ctx context.Context"}
+	expr := fmt.Sprintf("%q", path)
+	for _, param := range pathParams {
+		if typ, err := paramType(param); err != nil || typ != "string" {
+			return fmt.Errorf("parameter %s: only string path parameters are supported", param.Name)
+		}
+		arg := lowerFirst(goName(param.Name))
+		args = append(args, arg+" string")
+		expr = strings.Replace(expr, "{"+param.Name+"}", `" + url.PathEscape(`+arg+`) + "`, 1)
+	}
+	expr = strings.TrimSuffix(strings.TrimPrefix(expr, `"" + `), ` + ""`)
+	if len(queryParams) > 0 {
+		args = append(args, "params *"+name+"Params")
+	}
+	g.imports["context"] = true
+	g.imports["net/url"] = true
+
+	g.printf("// %s calls %s %s.\n", name, method, path)
+	comment(&g.body, "", operation.Description)
+	ptr := "*"
+	if strings.HasPrefix(result, "map[") {
+		ptr = ""
+	}
+	g.printf("func (c *Client) %s(%s) (%s%s, error) {\n", name, strings.Join(args, ", "), ptr, result)
+	g.printf("\tquery := url.Values{}\n")
+	if len(queryParams) > 0 {
+		g.printf("\tif params != nil {\n")
+		for _, param := range queryParams {
+			field := "params." + goName(param.Name)
+			value := "*" + field
+			if typ, _ := paramType(param); typ == "int" {
+				g.imports["strconv"] = true
+				value = "strconv.Itoa(*" + field + ")"
+			}
+			g.printf("\t\tif %s != nil {\n\t\t\tquery.Set(%q, %s)\n\t\t}\n", field, param.Name, value)
+		}
+		g.printf("\t}\n")
+	}
+	g.printf("\n\tvar result %s\n", result)
+	g.printf("\tif err := c.get(ctx, %s, query, &result); err != nil {\n\t\treturn nil, err\n\t}\n", expr)
+	if ptr == "" {
+		g.printf("\treturn result, nil\n}\n\n")
+	} else {
+		g.printf("\treturn &result, nil\n}\n\n")
+	}
+	return nil
+}
+
+func paramType(param *openapi3.Parameter) (string, error) {
+	if param.Schema == nil || param.Schema.Value == nil {
+		return "", fmt.Errorf("parameter %s has no schema", param.Name)
+	}
+	switch param.Schema.Value.Type {
+	case "string":
+		return "string", nil
+	case "integer":
+		return "int", nil
+	}
+	return "", fmt.Errorf("parameter %s: unsupported type %q", param.Name, param.Schema.Value.Type)
+}
+
+// enumValues lists the values of an enum for the comment of a parameter.
+func enumValues(enum []interface{}) string {
+	if len(enum) == 0 {
+		return ""
+	}
+	values := make([]string, 0, len(enum))
+	for _, value := range enum {
+		values = append(values, fmt.Sprintf("%q", value))
+	}
+	return " One of " + strings.Join(values, ", ") + "."
+}
+
+// comment writes the text as a comment, it writes nothing when the text is empty.
+func comment(out *bytes.Buffer, indent, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(out, "%s// %s\n", indent, line)
+	}
+}
+
+// goName turns a camelCase or snake_case name into an exported Go name, e.g. hostUserId is HostUserID.
+func goName(name string) string {
+	var words []string
+	for _, part := range strings.Split(name, "_") {
+		start := 0
+		for i := 1; i < len(part); i++ {
+			// a word starts at an upper case letter following a lower case one
+			if isUpper(part[i]) && !isUpper(part[i-1]) {
+				words = append(words, part[start:i])
+				start = i
+			}
+		}
+		if start < len(part) {
+			words = append(words, part[start:])
+		}
+	}
+
+	var b strings.Builder
+	for _, word := range words {
+		word = strings.ToUpper(word[:1]) + word[1:]
+		if initialisms[word] {
+			word = strings.ToUpper(word)
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
+
+func lowerFirst(name string) string {
+	if strings.ToUpper(name) == name {
+		return strings.ToLower(name)
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func isUpper(c byte) bool {
+	return 'A' <= c && c <= 'Z'
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package webextest
+
+import (
+	"time"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+// SAMPLING_INTERVAL is the sampling interval in seconds of the generated media quality data.
+const SAMPLING_INTERVAL = 60
+
+// fakeMeeting generates a meeting that started within the last week and lasted 30 to 90 minutes.
+// The caller must hold s.mu.
+func (s *Server) fakeMeeting() types.MeetingSeries {
+	now := time.Now().UTC()
+	start := s.faker.DateRange(now.AddDate(0, 0, -7), now.Add(-2*time.Hour)).Truncate(time.Minute)
+	end := start.Add(time.Duration(s.faker.Number(30, 90)) * time.Minute)
+	host := s.faker.Person()
+
+	return types.MeetingSeries{
+		ID:              s.faker.UUID(),
+		MeetingNumber:   s.faker.Numerify("#########"),
+		Title:           s.faker.HackerPhrase(),
+		Agenda:          s.faker.Sentence(8),
+		MeetingType:     "meeting",
+		State:           "ended",
+		Timezone:        "UTC",
+		Start:           start.Format(time.RFC3339),
+		End:             end.Format(time.RFC3339),
+		HostUserID:      s.faker.UUID(),
+		HostDisplayName: host.FirstName + " " + host.LastName,
+		HostEmail:       host.Contact.Email,
+		SiteURL:         "example.webex.com",
+		WebLink:         "https://example.webex.com/meet/" + s.faker.Username(),
+	}
+}
+
+// fakeMeetingQualities generates the media sessions of 2 to 5 participants of the meeting.
+// The caller must hold s.mu.
+func (s *Server) fakeMeetingQualities(meeting types.MeetingSeries) *types.MeetingQualities {
+	start, _ := time.Parse(time.RFC3339, meeting.Start)
+	end, _ := time.Parse(time.RFC3339, meeting.End)
+
+	qualities := &types.MeetingQualities{MeetingID: meeting.ID}
+	for i, n := 0, s.faker.Number(2, 5); i < n; i++ {
+		qualities.MediaSessions = append(qualities.MediaSessions, s.fakeSession(meeting.ID, start, end))
+	}
+
+	return qualities
+}
+
+// fakeSession generates the media session of a participant that joined within the first minutes of the meeting.
+// The caller must hold s.mu.
+func (s *Server) fakeSession(meetingID string, start, end time.Time) types.MediaSessionQuality {
+	joined := start.Add(time.Duration(s.faker.Number(0, 5)) * time.Minute)
+	person := s.faker.Person()
+	client := s.faker.RandomString([]string{"Webex Meetings Desktop", "Webex Mobile", "Webex Web App"})
+
+	session := types.MediaSessionQuality{
+		MeetingID:     meetingID,
+		DisplayName:   person.FirstName + " " + person.LastName,
+		Email:         person.Contact.Email,
+		Joined:        joined.Format(time.RFC3339),
+		Client:        client,
+		ClientVersion: s.faker.AppVersion(),
+		OsType:        s.faker.RandomString([]string{"windows", "mac", "ios", "android", "linux"}),
+		OsVersion:     s.faker.AppVersion(),
+		HardwareType:  s.faker.RandomString([]string{"Laptop", "Desktop", "Mobile"}),
+		SpeakerName:   s.faker.RandomString([]string{"Built-in Speakers", "Headset", "External Speakers"}),
+		NetworkType:   s.faker.RandomString([]string{"wifi", "ethernet", "cellular"}),
+		LocalIP:       s.faker.IPv4Address(),
+		PublicIP:      s.faker.IPv4Address(),
+		Camera:        s.faker.RandomString([]string{"FaceTime HD Camera", "Integrated Webcam", "Logitech C920"}),
+		Microphone:    s.faker.RandomString([]string{"Built-in Microphone", "Headset Microphone"}),
+		ServerRegion:  s.faker.RandomString([]string{"US East", "US West", "Europe", "Asia Pacific"}),
+		ParticipantID: s.faker.UUID(),
+	}
+
+	// one participant in four joined with the audio only, e.g. from a phone
+	if s.faker.Number(1, 4) > 1 {
+		session.VideoIn = s.fakeStream(joined, end, "H.264", 200000, 2500000, true)
+		session.VideoOut = s.fakeStream(joined, end, "H.264", 200000, 2500000, true)
+	}
+	session.AudioIn = s.fakeStream(joined, end, "opus", 20000, 64000, false)
+	session.AudioOut = s.fakeStream(joined, end, "opus", 20000, 64000, false)
+	if s.faker.Bool() {
+		session.ShareIn = s.fakeStream(joined, end, "H.264", 100000, 1500000, true)
+	}
+	if s.faker.Bool() {
+		session.ShareOut = s.fakeStream(joined, end, "H.264", 100000, 1500000, true)
+	}
+	session.Resources = s.fakeResources(session.AudioIn)
+
+	return session
+}
+
+// fakeStream generates consecutive intervals of quality data covering the time from start to end.
+// The caller must hold s.mu.
+func (s *Server) fakeStream(start, end time.Time, codec string, minBitRate, maxBitRate float32, video bool) []types.MediaQualityData {
+	var stream []types.MediaQualityData
+	transport := s.faker.RandomString([]string{"UDP", "TCP"})
+
+	for from := start; from.Before(end); {
+		samples := s.faker.Number(5, 10)
+		to := from.Add(time.Duration(samples*SAMPLING_INTERVAL) * time.Second)
+		if to.After(end) {
+			to = end
+			samples = int(to.Sub(from).Seconds()) / SAMPLING_INTERVAL
+			if samples == 0 {
+				break
+			}
+		}
+
+		data := types.MediaQualityData{
+			SamplingInterval: SAMPLING_INTERVAL,
+			StartTime:        from.Format(time.RFC3339),
+			EndTime:          to.Format(time.RFC3339),
+			Codec:            codec,
+			TransportType:    transport,
+		}
+		for i := 0; i < samples; i++ {
+			data.PacketLoss = append(data.PacketLoss, s.faker.Float32Range(0, 5))
+			data.Latency = append(data.Latency, s.faker.Float32Range(20, 300))
+			data.Jitter = append(data.Jitter, s.faker.Float32Range(0, 50))
+			data.MediaBitRate = append(data.MediaBitRate, s.faker.Float32Range(minBitRate, maxBitRate))
+			if video {
+				data.ResolutionHeight = append(data.ResolutionHeight, float32(s.faker.RandomInt([]int{360, 720, 1080})))
+				data.FrameRate = append(data.FrameRate, s.faker.Float32Range(15, 30))
+			}
+		}
+		stream = append(stream, data)
+
+		from = to
+	}
+
+	return stream
+}
+
+// fakeResources generates the CPU usage of the participant's device, sampled alongside the given stream.
+// The caller must hold s.mu.
+func (s *Server) fakeResources(stream []types.MediaQualityData) []types.Resources {
+	resources := make([]types.Resources, 0, len(stream))
+	for _, data := range stream {
+		r := types.Resources{
+			SamplingInterval: data.SamplingInterval,
+			StartTime:        data.StartTime,
+			EndTime:          data.EndTime,
+		}
+		for j := 0; j < len(data.PacketLoss); j++ {
+			processAvg := s.faker.Float32Range(5, 60)
+			systemAvg := processAvg + s.faker.Float32Range(5, 30)
+			r.ProcessAverageCPU = append(r.ProcessAverageCPU, processAvg)
+			r.ProcessMaxCPU = append(r.ProcessMaxCPU, processAvg+s.faker.Float32Range(0, 20))
+			r.SystemAverageCPU = append(r.SystemAverageCPU, systemAvg)
+			r.SystemMaxCPU = append(r.SystemMaxCPU, systemAvg+s.faker.Float32Range(0, 10))
+		}
+		resources = append(resources, r)
+	}
+
+	return resources
+}
@@ -0,0 +1,590 @@
+// Package webextest provides an in-process fake of the Webex API for end-to-end tests.
+//
+// The fake implements the endpoints used by the api package: the OAuth authorize and token endpoints,
+// the List Meetings endpoint with Link-header pagination and the Get Meeting Qualities endpoint.
+// Responses can be scripted per meeting, and for the meetings list, to exercise the 401, 429 and 204 paths of the client.
+package webextest
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+
+	"Webex.API.Integration.And.Visualization/types"
+)
+
+const (
+	// DEFAULT_PAGE_SIZE is the number of meetings listed when the request carries no "max" parameter.
+	DEFAULT_PAGE_SIZE = 10
+	// ACCESS_TOKEN_EXPIRES_IN is the lifetime in seconds of issued access tokens.
+	ACCESS_TOKEN_EXPIRES_IN = 1209600
+	// REFRESH_TOKEN_EXPIRES_IN is the lifetime in seconds of issued refresh tokens.
+	REFRESH_TOKEN_EXPIRES_IN = 7776000
+	// DEFAULT_PERSON_ID is the Webex user signed in until SignInAs is called.
+	DEFAULT_PERSON_ID = "fake-person"
+)
+
+// Response is a scripted response returned instead of the regular behaviour of an endpoint.
+type Response struct {
+	// Status is the HTTP status code of the response.
+	Status int
+	// RetryAfter is sent as the Retry-After header when non-zero.
+	RetryAfter time.Duration
+	// Delay is how long the response is held back, e.g. to make the client time out.
+	Delay time.Duration
+}
+
+// Server is the fake Webex API. It is safe for concurrent use.
+type Server struct {
+	*httptest.Server
+
+	// ClientID and ClientSecret are the credentials of the only integration known to the fake.
+	ClientID     string
+	ClientSecret string
+
+	mu        sync.Mutex
+	faker     *gofakeit.Faker
+	meetings  []types.MeetingSeries
+	qualities map[string]*types.MeetingQualities
+	scripted  map[string][]Response
+	// scriptedMeetings are served instead of the meetings list
+	scriptedMeetings []Response
+	codes            map[string]grant
+	deniedScopes     map[string]bool
+	// person is the Webex user the following OAuth codes are issued to
+	person string
+	// accessTokens and refreshTokens map the issued tokens to what they were granted for
+	accessTokens  map[string]grant
+	refreshTokens map[string]grant
+	// keepRefreshTokens makes refreshes answer without a refresh token, the one used stays valid
+	keepRefreshTokens bool
+	calls             map[string]int
+}
+
+// NewServer starts a fake Webex API accepting the given integration credentials.
+// The seed makes the generated meetings and qualities reproducible.
+// The caller should call Close when finished, to shut it down.
+func NewServer(clientID, clientSecret string, seed int64) *Server {
+	s := &Server{
+		ClientID:      clientID,
+		ClientSecret:  clientSecret,
+		faker:         gofakeit.New(seed),
+		qualities:     map[string]*types.MeetingQualities{},
+		scripted:      map[string][]Response{},
+		codes:         map[string]grant{},
+		deniedScopes:  map[string]bool{},
+		person:        DEFAULT_PERSON_ID,
+		accessTokens:  map[string]grant{},
+		refreshTokens: map[string]grant{},
+		calls:         map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/authorize", s.authorize)
+	mux.HandleFunc("/v1/access_token", s.accessToken)
+	mux.HandleFunc("/v1/people/me", s.peopleMe)
+	mux.HandleFunc("/v1/meetings", s.listMeetings)
+	mux.HandleFunc("/analytics/v1/meeting/qualities", s.meetingQualities)
+	s.Server = httptest.NewServer(s.count(mux))
+
+	return s
+}
+
+// BaseURL is the root of the fake REST API, to be used as the client's base URL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// AnalyticsBaseURL is the root of the fake analytics API, to be used as the client's analytics base URL.
+func (s *Server) AnalyticsBaseURL() string {
+	return s.URL + "/analytics/v1"
+}
+
+// Calls returns the number of requests received for the path, e.g. "/v1/access_token".
+func (s *Server) Calls(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[path]
+}
+
+// grant is what an OAuth code was issued for.
+type grant struct {
+	// codeChallenge is the PKCE code challenge, empty without PKCE.
+	codeChallenge string
+	// scope is the space separated list of granted scopes, empty if unrestricted.
+	scope string
+	// person is the ID of the Webex user who granted access.
+	person string
+}
+
+// IssueCode registers a new OAuth code that can be exchanged for an unrestricted access token without PKCE.
+func (s *Server) IssueCode() string {
+	return s.issueCode(grant{})
+}
+
+func (s *Server) issueCode(g grant) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code := randomToken()
+	g.person = s.person
+	s.codes[code] = g
+	return code
+}
+
+// SignInAs makes the Webex user with the ID grant the following authorizations, DEFAULT_PERSON_ID is signed in at first.
+// Every user can access the same meetings and qualities.
+func (s *Server) SignInAs(personID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.person = personID
+}
+
+// DenyScopes makes the user decline the scopes in the following authorizations, the other scopes are still granted.
+func (s *Server) DenyScopes(scopes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, scope := range scopes {
+		s.deniedScopes[scope] = true
+	}
+}
+
+// AllowScopes makes the user grant the scopes denied with DenyScopes again.
+func (s *Server) AllowScopes(scopes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, scope := range scopes {
+		delete(s.deniedScopes, scope)
+	}
+}
+
+// ExpireAccessTokens invalidates every access token issued so far, the next API call will get a 401.
+func (s *Server) ExpireAccessTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accessTokens = map[string]grant{}
+}
+
+// ExpireRefreshTokens invalidates every refresh token issued so far, the next refresh will get a 400.
+func (s *Server) ExpireRefreshTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshTokens = map[string]grant{}
+}
+
+// KeepRefreshTokens makes the following refreshes answer without a refresh token, as Webex does
+// when the refresh token is kept as is.
+func (s *Server) KeepRefreshTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keepRefreshTokens = true
+}
+
+// AddMeetings generates n meetings held in the last week, each with the qualities of 2 to 5 participants.
+func (s *Server) AddMeetings(n int) []types.MeetingSeries {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	added := make([]types.MeetingSeries, 0, n)
+	for i := 0; i < n; i++ {
+		meeting := s.fakeMeeting()
+		s.meetings = append(s.meetings, meeting)
+		s.qualities[meeting.ID] = s.fakeMeetingQualities(meeting)
+		added = append(added, meeting)
+	}
+
+	return added
+}
+
+// SetMeeting replaces the meeting with the same ID, e.g. to give it a title the generator would not.
+func (s *Server) SetMeeting(meeting types.MeetingSeries) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.meetings {
+		if s.meetings[i].ID == meeting.ID {
+			s.meetings[i] = meeting
+			return
+		}
+	}
+	s.meetings = append(s.meetings, meeting)
+}
+
+// SetQualities replaces the qualities returned for a meeting.
+func (s *Server) SetQualities(meetingID string, qualities *types.MeetingQualities) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.qualities[meetingID] = qualities
+}
+
+// Qualities returns the qualities the fake serves for a meeting, nil if there are none.
+func (s *Server) Qualities(meetingID string) *types.MeetingQualities {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.qualities[meetingID]
+}
+
+// ScriptQualities queues responses for the meeting qualities of meetingID.
+// Each request consumes one response, once the queue is drained the fake serves the qualities again.
+func (s *Server) ScriptQualities(meetingID string, responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripted[meetingID] = append(s.scripted[meetingID], responses...)
+}
+
+// ScriptMeetings queues responses for the meetings list, like ScriptQualities.
+func (s *Server) ScriptMeetings(responses ...Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scriptedMeetings = append(s.scriptedMeetings, responses...)
+}
+
+func (s *Server) count(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls[r.URL.Path]++
+		s.mu.Unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authorize stands in for the Webex login, the user always grants access and is redirected back with a code.
+// A PKCE code challenge must use the S256 method, the code is then only exchanged with the matching verifier.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.ClientID {
+		writeError(w, http.StatusBadRequest, "Invalid client_id")
+		return
+	}
+
+	challenge := q.Get("code_challenge")
+	if challenge != "" && q.Get("code_challenge_method") != "S256" {
+		writeError(w, http.StatusBadRequest, "Unsupported code_challenge_method")
+		return
+	}
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || redirect.Host == "" {
+		writeError(w, http.StatusBadRequest, "Invalid redirect_uri")
+		return
+	}
+
+	s.mu.Lock()
+	granted := []string{}
+	for _, scope := range strings.Fields(q.Get("scope")) {
+		if !s.deniedScopes[scope] {
+			granted = append(granted, scope)
+		}
+	}
+	s.mu.Unlock()
+
+	rq := redirect.Query()
+	rq.Set("code", s.issueCode(grant{codeChallenge: challenge, scope: strings.Join(granted, " ")}))
+	rq.Set("state", q.Get("state"))
+	redirect.RawQuery = rq.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// accessToken handles both the authorization_code and the refresh_token grants.
+// Parameters are accepted as form values or as a JSON object.
+func (s *Server) accessToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	params := map[string]string{}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		for k := range r.PostForm {
+			params[k] = r.PostForm.Get(k)
+		}
+	} else if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if params["client_id"] != s.ClientID || params["client_secret"] != s.ClientSecret {
+		writeError(w, http.StatusUnauthorized, "Invalid client credentials")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var g grant
+	switch params["grant_type"] {
+	case "authorization_code":
+		var ok bool
+		if g, ok = s.codes[params["code"]]; !ok {
+			writeError(w, http.StatusUnauthorized, "Invalid OAuth code")
+			return
+		}
+		delete(s.codes, params["code"])
+
+		if g.codeChallenge != "" {
+			sum := sha256.Sum256([]byte(params["code_verifier"]))
+			if base64.RawURLEncoding.EncodeToString(sum[:]) != g.codeChallenge {
+				writeError(w, http.StatusBadRequest, "Invalid code_verifier")
+				return
+			}
+		}
+
+	case "refresh_token":
+		var ok bool
+		if g, ok = s.refreshTokens[params["refresh_token"]]; !ok {
+			writeError(w, http.StatusBadRequest, "Invalid refresh token")
+			return
+		}
+		if s.keepRefreshTokens {
+			auth := types.AuthResponse{AccessToken: randomToken(), ExpiresIn: ACCESS_TOKEN_EXPIRES_IN}
+			s.accessTokens[auth.AccessToken] = g
+			writeJSON(w, http.StatusOK, auth)
+			return
+		}
+		delete(s.refreshTokens, params["refresh_token"])
+
+	default:
+		writeError(w, http.StatusBadRequest, "Unsupported grant_type")
+		return
+	}
+
+	auth := types.AuthResponse{
+		AccessToken:           randomToken(),
+		ExpiresIn:             ACCESS_TOKEN_EXPIRES_IN,
+		RefreshToken:          randomToken(),
+		RefreshTokenExpiresIn: REFRESH_TOKEN_EXPIRES_IN,
+		Scope:                 g.scope,
+	}
+	s.accessTokens[auth.AccessToken] = g
+	s.refreshTokens[auth.RefreshToken] = g
+
+	writeJSON(w, http.StatusOK, auth)
+}
+
+// listMeetings serves the scripted responses first, then the meetings page by page, the next page is advertised in the Link header.
+func (s *Server) listMeetings(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	var scripted *Response
+	if len(s.scriptedMeetings) > 0 {
+		scripted = &s.scriptedMeetings[0]
+		s.scriptedMeetings = s.scriptedMeetings[1:]
+	}
+	s.mu.Unlock()
+
+	if scripted != nil {
+		writeScripted(w, r, *scripted)
+		return
+	}
+
+	if _, ok := s.authorized(w, r, "meeting:schedules_read"); !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	pageSize := DEFAULT_PAGE_SIZE
+	if max := q.Get("max"); max != "" {
+		n, err := strconv.Atoi(max)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "Invalid max")
+			return
+		}
+		pageSize = n
+	}
+	offset, _ := strconv.Atoi(q.Get("offset"))
+
+	s.mu.Lock()
+	var matched []types.MeetingSeries
+	for _, meeting := range s.meetings {
+		if matchesMeeting(meeting, q) {
+			matched = append(matched, meeting)
+		}
+	}
+	s.mu.Unlock()
+
+	if offset > len(matched) {
+		offset = len(matched)
+	}
+	end := offset + pageSize
+	if end > len(matched) {
+		end = len(matched)
+	}
+
+	if end < len(matched) {
+		next := *r.URL
+		next.Scheme = "http"
+		next.Host = r.Host
+		nq := next.Query()
+		nq.Set("offset", strconv.Itoa(end))
+		nq.Set("max", strconv.Itoa(pageSize))
+		next.RawQuery = nq.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+
+	items := matched[offset:end]
+	if items == nil {
+		items = []types.MeetingSeries{}
+	}
+	writeJSON(w, http.StatusOK, types.MeetingsList{Items: items})
+}
+
+// meetingQualities serves the scripted responses first and the generated qualities after.
+func (s *Server) meetingQualities(w http.ResponseWriter, r *http.Request) {
+	meetingID := r.URL.Query().Get("meetingId")
+
+	s.mu.Lock()
+	var scripted *Response
+	if queue := s.scripted[meetingID]; len(queue) > 0 {
+		scripted = &queue[0]
+		s.scripted[meetingID] = queue[1:]
+	}
+	qualities := s.qualities[meetingID]
+	s.mu.Unlock()
+
+	if scripted != nil {
+		writeScripted(w, r, *scripted)
+		return
+	}
+
+	if _, ok := s.authorized(w, r, "analytics:read_all"); !ok {
+		return
+	}
+
+	if qualities == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Items []types.MediaSessionQuality `json:"items"`
+	}{qualities.MediaSessions})
+}
+
+// peopleMe serves the details of the user who granted the access token, it needs the spark:people_read scope.
+func (s *Server) peopleMe(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.authorized(w, r, "spark:people_read")
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, types.Person{
+		ID:          g.person,
+		DisplayName: g.person,
+		Emails:      []string{g.person + "@example.com"},
+	})
+}
+
+// authorized checks the access token of the request was granted the scope, answering 401 or 403 when it was not.
+// An empty scope only requires a valid access token. It returns what the access token was granted for.
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request, scope string) (grant, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	s.mu.Lock()
+	granted, ok := s.accessTokens[token]
+	s.mu.Unlock()
+
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "The request requires a valid access token set in the Authorization request header.")
+		return grant{}, false
+	}
+	if scope != "" && granted.scope != "" && !containsField(granted.scope, scope) {
+		writeError(w, http.StatusForbidden, "The access token was not granted the "+scope+" scope.")
+		return grant{}, false
+	}
+	return granted, true
+}
+
+func containsField(fields, field string) bool {
+	for _, f := range strings.Fields(fields) {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMeeting applies the List Meetings query parameters supported by the fake.
+func matchesMeeting(meeting types.MeetingSeries, q url.Values) bool {
+	start, _ := time.Parse(time.RFC3339, meeting.Start)
+	if from, err := time.Parse(time.RFC3339, q.Get("from")); err == nil && start.Before(from) {
+		return false
+	}
+	if to, err := time.Parse(time.RFC3339, q.Get("to")); err == nil && !start.Before(to) {
+		return false
+	}
+	for param, value := range map[string]string{
+		"meetingType":   meeting.MeetingType,
+		"state":         meeting.State,
+		"hostEmail":     meeting.HostEmail,
+		"siteUrl":       meeting.SiteURL,
+		"meetingNumber": meeting.MeetingNumber,
+		"webLink":       meeting.WebLink,
+	} {
+		if want := q.Get(param); want != "" && want != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writeScripted answers the scripted response once its delay has passed, or not at all if the client went away.
+func writeScripted(w http.ResponseWriter, r *http.Request, scripted Response) {
+	if scripted.Delay > 0 {
+		select {
+		case <-time.After(scripted.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if scripted.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(scripted.RetryAfter.Seconds())))
+	}
+	if scripted.Status == http.StatusNoContent {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	writeError(w, scripted.Status, http.StatusText(scripted.Status))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error body shaped like the ones returned by Webex.
+func writeError(w http.ResponseWriter, status int, message string) {
+	trackingID := "WEBEXTEST_" + randomToken()
+	w.Header().Set("TrackingID", trackingID)
+
+	var body types.HTTP4XXError
+	body.Message = message
+	body.Errors = append(body.Errors, struct {
+		Description string `json:"description"`
+	}{message})
+	body.TrackingID = trackingID
+	writeJSON(w, status, body)
+}
+
+func randomToken() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(buf)
+}